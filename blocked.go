@@ -0,0 +1,118 @@
+package googletrans
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mind1949/googletrans/tkk"
+)
+
+const defaultCoolDown = 10 * time.Minute
+
+var (
+	errCaptcha = tkk.ErrCaptcha
+
+	// blockMarkers are found in google's captcha and unusual traffic pages
+	blockMarkers = [][]byte{
+		[]byte("/sorry/index"),
+		[]byte("unusual traffic"),
+		[]byte("g-recaptcha"),
+	}
+)
+
+// ErrBlocked means a service host answered with its captcha page,
+// requests are sent to other hosts until the cool-down is over
+type ErrBlocked struct {
+	Host     string        // scheme://host of the service
+	CoolDown time.Duration // how long the host should be left alone
+}
+
+func (e *ErrBlocked) Error() string {
+	return fmt.Sprintf("blocked by %s, cool down for %s", e.Host, e.CoolDown)
+}
+
+// checkRedirect fails requests redirected to google's captcha page
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if strings.HasPrefix(req.URL.Path, "/sorry/") {
+		return errCaptcha
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// isBlocked reports whether resp, whose body is body, is a block page
+// instead of translation data
+func isBlocked(resp *http.Response, body []byte) bool {
+	// error pages are html too, only an html translation is an interstitial
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode == http.StatusOK && mediaType == "text/html" {
+		return true
+	}
+	return isBlockedPage(resp, body)
+}
+
+// isBlockedPage reports whether resp is google's captcha or unusual traffic page,
+// markers are only looked for in error pages since translations may contain them
+func isBlockedPage(resp *http.Response, body []byte) bool {
+	if resp.Request != nil && strings.HasPrefix(resp.Request.URL.Path, "/sorry/") {
+		return true
+	}
+	if resp.StatusCode == http.StatusOK {
+		return false
+	}
+	for _, marker := range blockMarkers {
+		if bytes.Contains(body, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPage fails google translation pages that are block pages,
+// so that tkk isn't fetched again and again from a blocked host
+func checkPage(resp *http.Response, page []byte) error {
+	if isBlockedPage(resp, page) {
+		return errCaptcha
+	}
+	return nil
+}
+
+// coolDown is the Retry-After of resp, which may be nil, or defaultCoolDown
+func coolDown(resp *http.Response) time.Duration {
+	if resp == nil {
+		return defaultCoolDown
+	}
+	retryAfter := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil && time.Until(date) > 0 {
+		return time.Until(date)
+	}
+	return defaultCoolDown
+}
+
+// blocked records that serviceURL blocked r, by ejecting r's proxy,
+// or leaving serviceURL out for its cool-down if r is the direct route
+func (t *Translator) blocked(r *route, serviceURL string, resp *http.Response) *ErrBlocked {
+	err := &ErrBlocked{Host: serviceURL, CoolDown: coolDown(resp)}
+	var status int
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	t.health.failure(serviceURL, status)
+	if r.proxy != nil {
+		t.eject(r)
+	} else {
+		t.health.block(serviceURL, time.Now().Add(err.CoolDown))
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package googletrans
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/googletranstest"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+// newBlockingServer starts a translation service that blocks translations with block
+func newBlockingServer(t *testing.T, block func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	fake := newTestServer()
+	t.Cleanup(fake.Close)
+	return newWrappedServer(fake, func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if block != nil && r.URL.Path == "/translate_a/single" {
+			block(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestBlocked(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		block    func(w http.ResponseWriter, r *http.Request)
+		coolDown time.Duration
+	}{
+		{
+			name: "redirect",
+			block: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/sorry/index?continue=x", http.StatusFound)
+			},
+			coolDown: defaultCoolDown,
+		},
+		{
+			name: "interstitial",
+			block: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+				fmt.Fprint(w, "<html><body>please wait</body></html>")
+			},
+			coolDown: defaultCoolDown,
+		},
+		{
+			name: "unusual traffic",
+			block: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "120")
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, "Our systems have detected unusual traffic from your computer network.")
+			},
+			coolDown: 2 * time.Minute,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			blocking := newBlockingServer(t, tt.block)
+			defer blocking.Close()
+			translator := NewWithOptions(
+				WithServiceURLs(blocking.URL),
+				WithHostPolicy(transcookie.AnyHost),
+			)
+			defer translator.Close()
+
+			for i := 0; i < 2; i++ {
+				_, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+				var blocked *ErrBlocked
+				if !errors.As(err, &blocked) {
+					t.Fatalf("expect ErrBlocked, got: %v", err)
+				}
+				if blocked.Host != blocking.URL || blocked.CoolDown > tt.coolDown || blocked.CoolDown < tt.coolDown-time.Minute {
+					t.Errorf("wrong ErrBlocked: %+v", blocked)
+				}
+			}
+			if stats := translator.Stats()[blocking.URL]; stats.Failures != 1 || !stats.BlockedUntil.After(time.Now()) {
+				t.Errorf("expect one failure and the host to be blocked, got: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestBlockedHostSkipped(t *testing.T) {
+	blocking := newBlockingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sorry/index", http.StatusFound)
+	})
+	defer blocking.Close()
+	working := newBlockingServer(t, nil)
+	defer working.Close()
+
+	translator := NewWithOptions(
+		WithServiceURLs(blocking.URL, working.URL),
+		WithHostPolicy(transcookie.AnyHost),
+	)
+	defer translator.Close()
+
+	var blocked int
+	for i := 0; i < 20; i++ {
+		_, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+		var e *ErrBlocked
+		switch {
+		case errors.As(err, &e):
+			blocked++
+		case err != nil:
+			t.Fatal(err)
+		}
+	}
+	if blocked > 1 {
+		t.Errorf("expect the blocked host to be skipped, got blocked %d times", blocked)
+	}
+}
+
+func TestBlockMarkersTranslated(t *testing.T) {
+	srv := googletranstest.NewServer()
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+
+	var text []string
+	for _, marker := range blockMarkers {
+		text = append(text, string(marker))
+	}
+	for _, text := range []string{"we noticed " + strings.Join(text, ", "), "hello"} {
+		translated, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: text})
+		if err != nil {
+			t.Fatalf("expect %q to be translated, got: %v", text, err)
+		}
+		if translated.Text != text {
+			t.Errorf("wrong translation of %q: %q", text, translated.Text)
+		}
+	}
+}
+
+func TestBlockedTkkPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "Our systems have detected unusual traffic from your computer network.")
+	}))
+	defer srv.Close()
+	translator := NewWithOptions(
+		WithServiceURLs(srv.URL),
+		WithHostPolicy(transcookie.AnyHost),
+	)
+	defer translator.Close()
+
+	start := time.Now()
+	_, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+	var blocked *ErrBlocked
+	if !errors.As(err, &blocked) {
+		t.Fatalf("expect ErrBlocked, got: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expect the captcha on the tkk page to be reported right away, took %v", time.Since(start))
+	}
+}
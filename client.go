@@ -0,0 +1,93 @@
+package googletrans
+
+import (
+	"context"
+)
+
+// Client translates text and detects languages,
+// callers can depend on it to mock or decorate a Translator
+type Client interface {
+	Translate(params TranslateParams) (Translated, error)
+	TranslateContext(ctx context.Context, params TranslateParams) (Translated, error)
+	Detect(text string) (Detected, error)
+	DetectContext(ctx context.Context, text string) (Detected, error)
+}
+
+var _ Client = (*Translator)(nil)
+
+// Result is the result of a translation call,
+// detections are translations of the text to english
+type Result struct {
+	Translated Translated        `json:"translated"`
+	Detected   Detected          `json:"detected"`
+	Dictionary []DictionaryEntry `json:"dictionary,omitempty"` // translations of a single word by part of speech
+}
+
+// Handler handles the translation calls of a Translator
+type Handler interface {
+	Handle(ctx context.Context, params TranslateParams) (Result, error)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as Handler
+type HandlerFunc func(ctx context.Context, params TranslateParams) (Result, error)
+
+// Handle calls f(ctx, params)
+func (f HandlerFunc) Handle(ctx context.Context, params TranslateParams) (Result, error) {
+	return f(ctx, params)
+}
+
+// Use wraps the translation calls of t in middlewares,
+// the first one is the outermost, for example a cache:
+//
+//	t.Use(func(next googletrans.Handler) googletrans.Handler {
+//		return googletrans.HandlerFunc(func(ctx context.Context, params googletrans.TranslateParams) (googletrans.Result, error) {
+//			if result, ok := cache.Load(params); ok {
+//				return result.(googletrans.Result), nil
+//			}
+//			result, err := next.Handle(ctx, params)
+//			if err == nil {
+//				cache.Store(params, result)
+//			}
+//			return result, err
+//		})
+//	})
+func (t *Translator) Use(middlewares ...func(next Handler) Handler) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.middlewares = append(t.middlewares, middlewares...)
+	var h Handler = HandlerFunc(t.handle)
+	for i := len(t.middlewares) - 1; i >= 0; i-- {
+		h = t.middlewares[i](h)
+	}
+	t.handler = h
+}
+
+// getHandler returns the handler of t's translation calls
+func (t *Translator) getHandler() Handler {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	if t.handler == nil {
+		return HandlerFunc(t.handle)
+	}
+	return t.handler
+}
+
+// handle sends the translation call to the service
+func (t *Translator) handle(ctx context.Context, params TranslateParams) (Result, error) {
+	transData, err := t.do(ctx, params)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Translated: Translated{
+			Params:        params,
+			Text:          transData.translated.text,
+			Pronunciation: transData.translated.pronunciation,
+		},
+		Detected: Detected{
+			Lang:       transData.detected.originalLanguage,
+			Confidence: transData.detected.confidence,
+		},
+		Dictionary: transData.translated.dictionary,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package googletrans
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+
+	var (
+		calls []string
+		cache sync.Map
+	)
+	logging := func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, params TranslateParams) (Result, error) {
+			calls = append(calls, params.Src+">"+params.Dest)
+			return next.Handle(ctx, params)
+		})
+	}
+	caching := func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, params TranslateParams) (Result, error) {
+			if result, ok := cache.Load(params); ok {
+				return result.(Result), nil
+			}
+			result, err := next.Handle(ctx, params)
+			if err == nil {
+				cache.Store(params, result)
+			}
+			return result, err
+		})
+	}
+	glossary := func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, params TranslateParams) (Result, error) {
+			result, err := next.Handle(ctx, params)
+			result.Translated.Text = strings.Replace(result.Translated.Text, "Go是", "Golang是", 1)
+			return result, err
+		})
+	}
+	translator.Use(logging, caching)
+	translator.Use(glossary)
+
+	var client Client = translator
+	for i := 0; i < 3; i++ {
+		translated, err := client.Translate(TranslateParams{Dest: "zh-CN", Text: goText})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(translated.Text, "Golang是") {
+			t.Errorf("expect the glossary to apply, got: %s", translated.Text)
+		}
+	}
+	detected, err := client.Detect(goText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detected.Lang != "en" {
+		t.Errorf("wrong detection: %+v", detected)
+	}
+
+	if expect := "auto>zh-CN auto>zh-CN auto>zh-CN auto>en"; strings.Join(calls, " ") != expect {
+		t.Errorf("expect calls: %s, got: %s", expect, strings.Join(calls, " "))
+	}
+	if n := srv.Requests(); n != 2 {
+		t.Errorf("expect the cache to leave 2 translation requests, got %d", n)
+	}
+}
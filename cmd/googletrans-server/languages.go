@@ -0,0 +1,143 @@
+package main
+
+import "strings"
+
+// language is a supported language as the languages method lists it
+type language struct {
+	Language string `json:"language"`
+	Name     string `json:"name,omitempty"`
+}
+
+// languages are the languages google translate supports, with english names
+var languages = []language{
+	{"af", "Afrikaans"},
+	{"am", "Amharic"},
+	{"ar", "Arabic"},
+	{"az", "Azerbaijani"},
+	{"be", "Belarusian"},
+	{"bg", "Bulgarian"},
+	{"bn", "Bengali"},
+	{"bs", "Bosnian"},
+	{"ca", "Catalan"},
+	{"ceb", "Cebuano"},
+	{"co", "Corsican"},
+	{"cs", "Czech"},
+	{"cy", "Welsh"},
+	{"da", "Danish"},
+	{"de", "German"},
+	{"el", "Greek"},
+	{"en", "English"},
+	{"eo", "Esperanto"},
+	{"es", "Spanish"},
+	{"et", "Estonian"},
+	{"eu", "Basque"},
+	{"fa", "Persian"},
+	{"fi", "Finnish"},
+	{"fr", "French"},
+	{"fy", "Frisian"},
+	{"ga", "Irish"},
+	{"gd", "Scots Gaelic"},
+	{"gl", "Galician"},
+	{"gu", "Gujarati"},
+	{"ha", "Hausa"},
+	{"haw", "Hawaiian"},
+	{"hi", "Hindi"},
+	{"hmn", "Hmong"},
+	{"hr", "Croatian"},
+	{"ht", "Haitian Creole"},
+	{"hu", "Hungarian"},
+	{"hy", "Armenian"},
+	{"id", "Indonesian"},
+	{"ig", "Igbo"},
+	{"is", "Icelandic"},
+	{"it", "Italian"},
+	{"iw", "Hebrew"},
+	{"ja", "Japanese"},
+	{"jw", "Javanese"},
+	{"ka", "Georgian"},
+	{"kk", "Kazakh"},
+	{"km", "Khmer"},
+	{"kn", "Kannada"},
+	{"ko", "Korean"},
+	{"ku", "Kurdish (Kurmanji)"},
+	{"ky", "Kyrgyz"},
+	{"la", "Latin"},
+	{"lb", "Luxembourgish"},
+	{"lo", "Lao"},
+	{"lt", "Lithuanian"},
+	{"lv", "Latvian"},
+	{"mg", "Malagasy"},
+	{"mi", "Maori"},
+	{"mk", "Macedonian"},
+	{"ml", "Malayalam"},
+	{"mn", "Mongolian"},
+	{"mr", "Marathi"},
+	{"ms", "Malay"},
+	{"mt", "Maltese"},
+	{"my", "Myanmar (Burmese)"},
+	{"ne", "Nepali"},
+	{"nl", "Dutch"},
+	{"no", "Norwegian"},
+	{"ny", "Chichewa"},
+	{"or", "Odia (Oriya)"},
+	{"pa", "Punjabi"},
+	{"pl", "Polish"},
+	{"ps", "Pashto"},
+	{"pt", "Portuguese"},
+	{"ro", "Romanian"},
+	{"ru", "Russian"},
+	{"rw", "Kinyarwanda"},
+	{"sd", "Sindhi"},
+	{"si", "Sinhala"},
+	{"sk", "Slovak"},
+	{"sl", "Slovenian"},
+	{"sm", "Samoan"},
+	{"sn", "Shona"},
+	{"so", "Somali"},
+	{"sq", "Albanian"},
+	{"sr", "Serbian"},
+	{"st", "Sesotho"},
+	{"su", "Sundanese"},
+	{"sv", "Swedish"},
+	{"sw", "Swahili"},
+	{"ta", "Tamil"},
+	{"te", "Telugu"},
+	{"tg", "Tajik"},
+	{"th", "Thai"},
+	{"tk", "Turkmen"},
+	{"tl", "Filipino"},
+	{"tr", "Turkish"},
+	{"tt", "Tatar"},
+	{"ug", "Uyghur"},
+	{"uk", "Ukrainian"},
+	{"ur", "Urdu"},
+	{"uz", "Uzbek"},
+	{"vi", "Vietnamese"},
+	{"xh", "Xhosa"},
+	{"yi", "Yiddish"},
+	{"yo", "Yoruba"},
+	{"zh", "Chinese (Simplified)"},
+	{"zh-CN", "Chinese (Simplified)"},
+	{"zh-TW", "Chinese (Traditional)"},
+	{"zu", "Zulu"},
+}
+
+// aliases are the codes google translate knows by older ones
+var aliases = map[string]string{
+	"he": "iw",
+	"jv": "jw",
+}
+
+// supported returns the code google translate uses for code,
+// ok is false if code isn't one of languages
+func supported(code string) (googleCode string, ok bool) {
+	if alias, ok := aliases[strings.ToLower(code)]; ok {
+		code = alias
+	}
+	for _, lang := range languages {
+		if strings.EqualFold(lang.Language, code) {
+			return lang.Language, true
+		}
+	}
+	return "", false
+}
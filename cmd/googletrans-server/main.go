@@ -0,0 +1,69 @@
+// Command googletrans-server serves the Google Cloud Translation v2 API
+// with google translate, so that services using the API can switch to it
+// by changing their base url.
+//
+// Usage:
+//
+//	googletrans-server [flags]
+//
+// It serves the translate, detect and languages methods at
+// /language/translate/v2, /language/translate/v2/detect and
+// /language/translate/v2/languages with the request and response
+// json of the API.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mind1949/googletrans/internal/cli"
+)
+
+func main() {
+	var (
+		tf          cli.TranslatorFlags
+		addr        = flag.String("addr", ":8080", "`address` to listen on")
+		key         = flag.String("key", "", "api `key` callers must pass, any if empty")
+		concurrency = flag.Int("concurrency", 4, "texts of a call translated at once")
+	)
+	tf.Register(flag.CommandLine)
+	flag.Parse()
+
+	translator, err := tf.Translator()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: newServer(translator, *key, *concurrency),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "googletrans-server: listening on %s\n", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+	if err := tf.Close(translator); err != nil {
+		log.Fatal(err)
+	}
+}
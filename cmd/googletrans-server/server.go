@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mind1949/googletrans"
+)
+
+// paths of the methods of the Cloud Translation v2 API
+const (
+	pathTranslate = "/language/translate/v2"
+	pathDetect    = "/language/translate/v2/detect"
+	pathLanguages = "/language/translate/v2/languages"
+)
+
+// maxBodySize limits the size of request bodies
+const maxBodySize = 1 << 20
+
+// request holds the parameters of a call, from the query, the form or the json body
+type request struct {
+	Q      queries `json:"q"`
+	Target string  `json:"target"`
+	Source string  `json:"source"`
+	Format string  `json:"format"`
+	Model  string  `json:"model"`
+	Key    string  `json:"key"`
+}
+
+// queries is the q parameter, a string or a list of strings in json bodies
+type queries []string
+
+func (q *queries) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*q = queries{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(q))
+}
+
+// parseRequest parses the parameters of r
+func parseRequest(r *http.Request) (req request, err error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+	if err = r.ParseForm(); err != nil {
+		return req, err
+	}
+	req = request{
+		Q:      r.Form["q"],
+		Target: r.Form.Get("target"),
+		Source: r.Form.Get("source"),
+		Format: r.Form.Get("format"),
+		Model:  r.Form.Get("model"),
+		Key:    r.Form.Get("key"),
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil && err != io.EOF {
+			return req, err
+		}
+	}
+	if req.Key == "" {
+		req.Key = r.Header.Get("X-Goog-Api-Key")
+	}
+	return req, nil
+}
+
+// apiError is an error in the shape of the Cloud Translation v2 API
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Errors  []struct {
+		Message string `json:"message"`
+		Domain  string `json:"domain"`
+		Reason  string `json:"reason"`
+	} `json:"errors"`
+
+	retryAfter time.Duration // for rate limit errors
+}
+
+func newAPIError(code int, reason, message string) *apiError {
+	e := &apiError{Code: code, Message: message}
+	e.Errors = append(e.Errors, struct {
+		Message string `json:"message"`
+		Domain  string `json:"domain"`
+		Reason  string `json:"reason"`
+	}{message, "global", reason})
+	return e
+}
+
+// backendError is the api error of a failed translation,
+// a blocked service is reported as exceeding the rate limit
+func backendError(err error) *apiError {
+	var blocked *googletrans.ErrBlocked
+	if errors.As(err, &blocked) {
+		e := newAPIError(http.StatusTooManyRequests, "rateLimitExceeded", err.Error())
+		e.retryAfter = blocked.CoolDown
+		return e
+	}
+	return newAPIError(http.StatusServiceUnavailable, "backendError", err.Error())
+}
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	writeJSON(w, e.Code, struct {
+		Error *apiError `json:"error"`
+	}{e})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// translation is a translated text of the translate method
+type translation struct {
+	TranslatedText         string `json:"translatedText"`
+	DetectedSourceLanguage string `json:"detectedSourceLanguage,omitempty"`
+}
+
+// detection is a detected language of the detect method
+type detection struct {
+	Language   string  `json:"language"`
+	Confidence float64 `json:"confidence"`
+}
+
+// detectedKey is the context key of where a translation's detection is kept
+type detectedKey struct{}
+
+// server serves the Cloud Translation v2 API with a Translator
+type server struct {
+	translator  *googletrans.Translator
+	key         string // api key callers must pass, any if empty
+	concurrency int    // translations of a call done at once
+
+	m     sync.Mutex
+	names map[string][]language // language names by target language
+}
+
+// newServer returns a server translating with translator
+func newServer(translator *googletrans.Translator, key string, concurrency int) *server {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// keep the detection of translations for detectedSourceLanguage
+	translator.Use(func(next googletrans.Handler) googletrans.Handler {
+		return googletrans.HandlerFunc(func(ctx context.Context, params googletrans.TranslateParams) (googletrans.Result, error) {
+			result, err := next.Handle(ctx, params)
+			if detected, ok := ctx.Value(detectedKey{}).(*googletrans.Detected); ok && err == nil {
+				*detected = result.Detected
+			}
+			return result, err
+		})
+	})
+	return &server{
+		translator:  translator,
+		key:         key,
+		concurrency: concurrency,
+		names:       make(map[string][]language),
+	}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handle func(ctx context.Context, req request) (interface{}, *apiError)
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case pathTranslate:
+		handle = s.translate
+	case pathDetect:
+		handle = s.detect
+	case pathLanguages:
+		handle = s.languages
+	default:
+		writeError(w, newAPIError(http.StatusNotFound, "notFound", "Not Found"))
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, newAPIError(http.StatusMethodNotAllowed, "httpMethodNotAllowed", "HTTP method not allowed"))
+		return
+	}
+
+	req, err := parseRequest(r)
+	if err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "parseError", "Parse Error: "+err.Error()))
+		return
+	}
+	if s.key != "" && req.Key != s.key {
+		writeError(w, newAPIError(http.StatusBadRequest, "badRequest", "API key not valid. Please pass a valid API key."))
+		return
+	}
+	data, e := handle(r.Context(), req)
+	if e != nil {
+		if e.Code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(int((e.retryAfter+time.Second-1)/time.Second)))
+		}
+		writeError(w, e)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Data interface{} `json:"data"`
+	}{data})
+}
+
+// translate is the translate method
+func (s *server) translate(ctx context.Context, req request) (interface{}, *apiError) {
+	if len(req.Q) == 0 {
+		return nil, newAPIError(http.StatusBadRequest, "required", "Required Text")
+	}
+	if req.Target == "" {
+		return nil, newAPIError(http.StatusBadRequest, "required", "Required Target")
+	}
+	dest, ok := supported(req.Target)
+	src, srcOK := "auto", true
+	if req.Source != "" {
+		src, srcOK = supported(req.Source)
+	}
+	if !ok || !srcOK {
+		return nil, newAPIError(http.StatusBadRequest, "invalid", "Bad language pair")
+	}
+	if req.Format != "" && req.Format != "text" && req.Format != "html" {
+		return nil, newAPIError(http.StatusBadRequest, "invalid", "Invalid Value")
+	}
+	// html is the default format, text without markup is unescaped
+	// for translating and the translation escaped as the API does
+	escape := func(q string) bool {
+		return req.Format != "text" && !strings.Contains(q, "<")
+	}
+
+	translations := make([]translation, len(req.Q))
+	err := s.each(ctx, len(req.Q), func(ctx context.Context, i int) error {
+		text := req.Q[i]
+		if escape(text) {
+			text = html.UnescapeString(text)
+		}
+		var detected googletrans.Detected
+		translated, err := s.translator.TranslateContext(context.WithValue(ctx, detectedKey{}, &detected), googletrans.TranslateParams{
+			Src:  src,
+			Dest: dest,
+			Text: text,
+		})
+		if err != nil {
+			return err
+		}
+		translations[i].TranslatedText = translated.Text
+		if escape(req.Q[i]) {
+			translations[i].TranslatedText = html.EscapeString(translated.Text)
+		}
+		if req.Source == "" {
+			translations[i].DetectedSourceLanguage = detected.Lang
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, backendError(err)
+	}
+	return struct {
+		Translations []translation `json:"translations"`
+	}{translations}, nil
+}
+
+// detect is the detect method
+func (s *server) detect(ctx context.Context, req request) (interface{}, *apiError) {
+	if len(req.Q) == 0 {
+		return nil, newAPIError(http.StatusBadRequest, "required", "Required Text")
+	}
+	detections := make([][]detection, len(req.Q))
+	err := s.each(ctx, len(req.Q), func(ctx context.Context, i int) error {
+		detected, err := s.translator.DetectContext(ctx, req.Q[i])
+		if err != nil {
+			return err
+		}
+		detections[i] = []detection{{Language: detected.Lang, Confidence: detected.Confidence}}
+		return nil
+	})
+	if err != nil {
+		return nil, backendError(err)
+	}
+	return struct {
+		Detections [][]detection `json:"detections"`
+	}{detections}, nil
+}
+
+// languages is the languages method, names are in the target language if one is given
+func (s *server) languages(ctx context.Context, req request) (interface{}, *apiError) {
+	list := make([]language, len(languages))
+	switch req.Target {
+	case "":
+		for i, lang := range languages {
+			list[i].Language = lang.Language
+		}
+	case "en":
+		copy(list, languages)
+	default:
+		target := req.Target
+		if code, ok := supported(target); ok {
+			target = code
+		}
+		var err error
+		if list, err = s.namesIn(ctx, target); err != nil {
+			return nil, backendError(err)
+		}
+	}
+	return struct {
+		Languages []language `json:"languages"`
+	}{list}, nil
+}
+
+// namesIn returns languages with the names translated to target,
+// the names are translated all at once and kept
+func (s *server) namesIn(ctx context.Context, target string) ([]language, error) {
+	s.m.Lock()
+	list, ok := s.names[target]
+	s.m.Unlock()
+	if ok {
+		return list, nil
+	}
+
+	names := make([]string, len(languages))
+	for i, lang := range languages {
+		names[i] = lang.Name
+	}
+	translated, err := s.translator.TranslateContext(ctx, googletrans.TranslateParams{
+		Src:  "en",
+		Dest: target,
+		Text: strings.Join(names, "\n"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(translated.Text, "\n")
+	if len(lines) != len(languages) {
+		return nil, fmt.Errorf("translated %d language names to %d lines", len(languages), len(lines))
+	}
+	list = make([]language, len(languages))
+	for i, lang := range languages {
+		list[i] = language{Language: lang.Language, Name: strings.TrimSpace(lines[i])}
+	}
+
+	s.m.Lock()
+	s.names[target] = list
+	s.m.Unlock()
+	return list, nil
+}
+
+// each calls fn for 0 to n-1, at most s.concurrency at once,
+// and returns the first error, the calls left are canceled after it
+func (s *server) each(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg    sync.WaitGroup
+		m     sync.Mutex
+		first error
+		sem   = make(chan struct{}, s.concurrency)
+	)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(ctx, i); err != nil {
+				m.Lock()
+				if first == nil {
+					first = err
+					cancel()
+				}
+				m.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return first
+}
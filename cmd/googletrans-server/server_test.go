@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mind1949/googletrans"
+	"github.com/mind1949/googletrans/googletranstest"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+func TestServer(t *testing.T) {
+	fake := googletranstest.NewServer(googletranstest.WithTranslate(func(src, dest, text string) googletranstest.Translation {
+		if text == "codes" {
+			return googletranstest.Translation{Text: src + " " + dest, Src: src, Confidence: 1}
+		}
+		lang := "en"
+		if strings.HasPrefix(text, "bonjour") {
+			lang = "fr"
+		}
+		return googletranstest.Translation{Text: strings.ToUpper(text), Src: lang, Confidence: 0.75}
+	}))
+	defer fake.Close()
+	translator := googletrans.NewWithOptions(
+		googletrans.WithServiceURLs(fake.URL),
+		googletrans.WithHostPolicy(transcookie.AnyHost),
+	)
+	defer translator.Close()
+	srv := httptest.NewServer(newServer(translator, "secret", 2))
+	defer srv.Close()
+
+	cases := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+		response    string
+	}{
+		{
+			"translate json", "POST", "/language/translate/v2?key=secret", "application/json",
+			`{"q":"hello","source":"en","target":"de","format":"text"}`, 200,
+			`{"data":{"translations":[{"translatedText":"HELLO"}]}}`,
+		},
+		{
+			"translate detects source", "POST", "/language/translate/v2?key=secret", "application/json; charset=utf-8",
+			`{"q":["hello","bonjour","it's"],"target":"de"}`, 200,
+			`{"data":{"translations":[
+				{"translatedText":"HELLO","detectedSourceLanguage":"en"},
+				{"translatedText":"BONJOUR","detectedSourceLanguage":"fr"},
+				{"translatedText":"IT&#39;S","detectedSourceLanguage":"en"}
+			]}}`,
+		},
+		{
+			"translate form", "POST", "/language/translate/v2", "application/x-www-form-urlencoded",
+			"q=a+%26amp%3B+b&q=%3Cb%3Ec%3C%2Fb%3E&target=de&source=en&key=secret", 200,
+			`{"data":{"translations":[{"translatedText":"A &amp; B"},{"translatedText":"<B>C</B>"}]}}`,
+		},
+		{
+			"translate get", "GET", "/language/translate/v2?q=hi&target=de&source=en&key=secret", "", "", 200,
+			`{"data":{"translations":[{"translatedText":"HI"}]}}`,
+		},
+		{
+			"translate aliases", "POST", "/language/translate/v2?key=secret", "application/json",
+			`{"q":"codes","source":"he","target":"JV","format":"text"}`, 200,
+			`{"data":{"translations":[{"translatedText":"iw jw"}]}}`,
+		},
+		{
+			"missing target", "POST", "/language/translate/v2?key=secret", "application/json", `{"q":"hello"}`, 400,
+			`{"error":{"code":400,"message":"Required Target","errors":[{"message":"Required Target","domain":"global","reason":"required"}]}}`,
+		},
+		{
+			"invalid target", "POST", "/language/translate/v2?key=secret", "application/json", `{"q":"hello","target":"xx"}`, 400,
+			`{"error":{"code":400,"message":"Bad language pair","errors":[{"message":"Bad language pair","domain":"global","reason":"invalid"}]}}`,
+		},
+		{
+			"invalid source", "POST", "/language/translate/v2?key=secret", "application/json", `{"q":"hello","source":"auto","target":"de"}`, 400,
+			`{"error":{"code":400,"message":"Bad language pair","errors":[{"message":"Bad language pair","domain":"global","reason":"invalid"}]}}`,
+		},
+		{
+			"invalid key", "POST", "/language/translate/v2?key=nope", "application/json", `{"q":"hello","target":"de"}`, 400,
+			`{"error":{"code":400,"message":"API key not valid. Please pass a valid API key.","errors":[{"message":"API key not valid. Please pass a valid API key.","domain":"global","reason":"badRequest"}]}}`,
+		},
+		{
+			"detect", "POST", "/language/translate/v2/detect", "application/json",
+			`{"q":["hello","bonjour"],"key":"secret"}`, 200,
+			`{"data":{"detections":[[{"language":"en","confidence":0.75}],[{"language":"fr","confidence":0.75}]]}}`,
+		},
+		{
+			"languages", "POST", "/language/translate/v2/languages?key=secret", "application/json", `{}`, 200, "",
+		},
+		{
+			"languages with names", "GET", "/language/translate/v2/languages?target=de&key=secret", "", "", 200, "",
+		},
+		{
+			"not found", "POST", "/language/translate/v3?key=secret", "", "", 404,
+			`{"error":{"code":404,"message":"Not Found","errors":[{"message":"Not Found","domain":"global","reason":"notFound"}]}}`,
+		},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, srv.URL+c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if resp.StatusCode != c.code {
+			t.Errorf("%s: expect status %d, got %d: %v", c.name, c.code, resp.StatusCode, got)
+			continue
+		}
+		if c.response == "" {
+			continue
+		}
+		var expect map[string]interface{}
+		if err := json.Unmarshal([]byte(c.response), &expect); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("%s: expect %v, got %v", c.name, expect, got)
+		}
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	fake := googletranstest.NewServer(googletranstest.WithTranslate(func(src, dest, text string) googletranstest.Translation {
+		return googletranstest.Translation{Text: strings.ToUpper(text), Src: src}
+	}))
+	defer fake.Close()
+	translator := googletrans.NewWithOptions(
+		googletrans.WithServiceURLs(fake.URL),
+		googletrans.WithHostPolicy(transcookie.AnyHost),
+	)
+	defer translator.Close()
+	srv := httptest.NewServer(newServer(translator, "", 1))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		target string
+		name   string // of german
+	}{
+		{"", ""},
+		{"en", "German"},
+		{"fr", "GERMAN"},
+		{"fr", "GERMAN"},
+	} {
+		resp, err := http.Get(srv.URL + "/language/translate/v2/languages?target=" + c.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Data struct {
+				Languages []language `json:"languages"`
+			} `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Data.Languages) != len(languages) {
+			t.Fatalf("target %q: expect %d languages, got %d", c.target, len(languages), len(got.Data.Languages))
+		}
+		for _, lang := range got.Data.Languages {
+			if lang.Language == "de" && lang.Name != c.name {
+				t.Errorf("target %q: expect german to be named %q, got %q", c.target, c.name, lang.Name)
+			}
+		}
+	}
+	// the names in french are translated once
+	if n := fake.Requests(); n != 1 {
+		t.Errorf("expect 1 translation request, got %d", n)
+	}
+}
+
+func TestServerBlocked(t *testing.T) {
+	fake := googletranstest.NewServer()
+	defer fake.Close()
+	translator := googletrans.NewWithOptions(
+		googletrans.WithServiceURLs(fake.URL),
+		googletrans.WithHostPolicy(transcookie.AnyHost),
+	)
+	defer translator.Close()
+	srv := httptest.NewServer(newServer(translator, "", 4))
+	defer srv.Close()
+
+	fake.Inject(googletranstest.Blocked)
+	resp, err := http.Post(srv.URL+"/language/translate/v2", "application/json", strings.NewReader(`{"q":"hello","target":"de"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("expect 429 with Retry-After, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
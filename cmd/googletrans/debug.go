@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mind1949/googletrans"
+	"github.com/mind1949/googletrans/internal/cli"
+	"github.com/mind1949/googletrans/tk"
+	"github.com/mind1949/googletrans/tkk"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+const defaultServiceURL = "https://translate.google.cn"
+
+// debugReport is what debug found out about a service url, stage by stage
+type debugReport struct {
+	ServiceURL string `json:"service_url"`
+
+	Status  string        `json:"status,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+
+	Tkk        string `json:"tkk,omitempty"`
+	TkkHour    int64  `json:"tkk_hour,omitempty"`
+	TkkCurrent bool   `json:"tkk_current"` // the tkk belongs to the current hour
+
+	Text string `json:"text"`
+	Tk   string `json:"tk,omitempty"`
+
+	Cookies []debugCookie `json:"cookies,omitempty"`
+
+	Translation string `json:"translation,omitempty"`
+
+	// the error of each stage, keyed by reachability, tkk, tk, cookies or translation
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// debugCookie is a cookie of a debugReport, its value is left out
+type debugCookie struct {
+	Name    string     `json:"name"`
+	Domain  string     `json:"domain"`
+	Expires *time.Time `json:"expires,omitempty"` // nil for a session cookie
+}
+
+func (r *debugReport) fail(stage string, err error) {
+	if r.Errors == nil {
+		r.Errors = make(map[string]string)
+	}
+	r.Errors[stage] = err.Error()
+}
+
+func runDebug(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var (
+		fs      = newFlagSet("debug", "debug [flags]", stderr)
+		tf      cli.TranslatorFlags
+		text    = fs.String("text", "hello world", "sample `text` tk is computed and translated for")
+		dest    = fs.String("dest", "zh-CN", "destination `language` of the test translation")
+		timeout = fs.Duration("timeout", 10*time.Second, "timeout of each stage")
+		output  = fs.String("output", outputText, "output `format`: text or json")
+	)
+	tf.Register(fs)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `Usage: googletrans debug [flags]
+
+Checks each service url stage by stage: reachability, tkk, tk, cookies
+and a test translation. Only the test translation goes through --proxy,
+without it the translation uses the tkk and cookies of the earlier stages.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	serviceURLs := tf.ServiceURLs
+	if len(serviceURLs) == 0 {
+		serviceURLs = cli.Strings{defaultServiceURL}
+	}
+
+	var failed bool
+	for _, serviceURL := range serviceURLs {
+		// each service url is checked on its own
+		single := tf
+		single.ServiceURLs = cli.Strings{serviceURL}
+		single.State = ""
+		report := debug(serviceURL, *text, *dest, *timeout, &single)
+		failed = failed || len(report.Errors) > 0
+
+		if *output == outputJSON {
+			data, err := marshal(report)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s\n", data)
+			continue
+		}
+		printReport(stdout, report)
+	}
+	if failed {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
+
+// debug checks serviceURL stage by stage,
+// a failing stage doesn't prevent the next ones from being checked
+func debug(serviceURL, text, dest string, timeout time.Duration, tf *cli.TranslatorFlags) debugReport {
+	policy := tf.Policy()
+	report := debugReport{ServiceURL: serviceURL, Text: text}
+	clt := &http.Client{Timeout: timeout}
+	u, err := url.Parse(serviceURL)
+	if err != nil || u.Host == "" {
+		report.fail("reachability", fmt.Errorf("invalid service url %q", serviceURL))
+		return report
+	}
+	if !policy(u.Hostname()) {
+		report.fail("reachability", fmt.Errorf("%s isn't a google translation host, use --any-host", u.Hostname()))
+		return report
+	}
+
+	start := time.Now()
+	resp, err := clt.Get(serviceURL)
+	if err != nil {
+		report.fail("reachability", err)
+	} else {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		report.Status = resp.Status
+		report.Latency = time.Since(start).Round(time.Millisecond)
+		if resp.StatusCode >= 400 {
+			report.fail("reachability", fmt.Errorf("status %s", resp.Status))
+		}
+	}
+
+	cache := tkk.NewCache(serviceURL, tkk.WithClient(clt), tkk.WithTimeout(timeout))
+	if report.Tkk, err = cache.Get(); err != nil {
+		report.fail("tkk", err)
+		report.fail("tk", errors.New("no tkk"))
+	} else {
+		var ok bool
+		if report.TkkHour, ok = tkk.Hour(report.Tkk); !ok {
+			report.fail("tkk", fmt.Errorf("invalid tkk %q", report.Tkk))
+		}
+		report.TkkCurrent = report.TkkHour == time.Now().Unix()/3600
+		if report.Tk, err = tk.Get(text, report.Tkk); err != nil {
+			report.fail("tk", err)
+		}
+	}
+
+	jar := transcookie.NewJar()
+	cookies := transcookie.NewCache(
+		transcookie.WithClient(clt),
+		transcookie.WithJar(jar),
+		transcookie.WithHostPolicy(policy),
+	)
+	if _, err = cookies.Get(serviceURL); err != nil {
+		report.fail("cookies", err)
+	} else if entries := jar.EntriesFor(u); len(entries) == 0 {
+		report.fail("cookies", errors.New("no cookies received"))
+	} else {
+		for _, entry := range entries {
+			cookie := debugCookie{Name: entry.Name, Domain: entry.Domain}
+			if entry.Persistent {
+				expires := entry.Expires
+				cookie.Expires = &expires
+			}
+			report.Cookies = append(report.Cookies, cookie)
+		}
+	}
+
+	var opts []googletrans.Option
+	if len(tf.Proxies) == 0 {
+		// translate with what the earlier stages obtained,
+		// proxies obtain their own
+		opts = append(opts, googletrans.WithTkk(cache), googletrans.WithCookieJar(jar))
+	}
+	translator, err := tf.Translator(opts...)
+	if err != nil {
+		report.fail("translation", err)
+		return report
+	}
+	defer translator.Close()
+	translated, err := translator.Translate(googletrans.TranslateParams{Dest: dest, Text: text})
+	if err != nil {
+		report.fail("translation", err)
+	} else {
+		report.Translation = translated.Text
+	}
+	return report
+}
+
+// printReport prints report as text
+func printReport(w io.Writer, report debugReport) {
+	fmt.Fprintln(w, report.ServiceURL)
+	stage := func(name, ok string) {
+		if err, failed := report.Errors[name]; failed {
+			ok = "FAILED: " + err
+		}
+		fmt.Fprintf(w, "  %-12s %s\n", name+":", ok)
+	}
+
+	stage("reachability", fmt.Sprintf("%s in %s", report.Status, report.Latency))
+	current := "current hour"
+	if !report.TkkCurrent {
+		current = "stale, the current hour is " + fmt.Sprint(time.Now().Unix()/3600)
+	}
+	stage("tkk", fmt.Sprintf("%s (hour %d, %s)", report.Tkk, report.TkkHour, current))
+	stage("tk", fmt.Sprintf("%s for %q", report.Tk, report.Text))
+
+	cookies := make([]string, 0, len(report.Cookies))
+	for _, cookie := range report.Cookies {
+		expiry := "session"
+		if cookie.Expires != nil {
+			expiry = "expires " + cookie.Expires.UTC().Format(time.RFC3339)
+		}
+		cookies = append(cookies, cookie.Name+" "+expiry)
+	}
+	stage("cookies", strings.Join(cookies, ", "))
+	stage("translation", fmt.Sprintf("%q", report.Translation))
+}
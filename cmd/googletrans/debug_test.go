@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mind1949/googletrans/googletranstest"
+	"github.com/mind1949/googletrans/tk"
+)
+
+func TestDebug(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	var homes int64
+	home := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			atomic.AddInt64(&homes, 1)
+		}
+		home.ServeHTTP(w, r)
+	})
+	closed := newTestServer()
+	closed.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"debug", "--service-url", srv.URL, "--service-url", closed.URL, "--any-host", "--timeout", "200ms"}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("expect exit code 1, got %d, stderr: %s", code, stderr.String())
+	}
+	sign, _ := tk.Get("hello world", srv.Tkk())
+	for _, expect := range []string{
+		srv.URL + "\n  reachability: 200 OK in ",
+		fmt.Sprintf("  tkk:         %s (hour %s, current hour)\n", srv.Tkk(), strings.Split(srv.Tkk(), ".")[0]),
+		fmt.Sprintf("  tk:          %s for \"hello world\"\n", sign),
+		"  cookies:     NID expires ",
+		"  translation: \"HELLO WORLD\"\n",
+		closed.URL + "\n  reachability: FAILED: ",
+		"  tkk:         FAILED: ",
+		"  tk:          FAILED: no tkk\n",
+	} {
+		if !strings.Contains(stdout.String(), expect) {
+			t.Errorf("expect %q in:\n%s", expect, stdout.String())
+		}
+	}
+	// reachability, tkk and cookies, the translation reuses the tkk and cookies
+	if n := atomic.LoadInt64(&homes); n != 3 {
+		t.Errorf("expect 3 requests of the home page, got %d", n)
+	}
+
+	srv.Inject(googletranstest.Blocked)
+	stdout.Reset()
+	args = []string{"debug", "--service-url", srv.URL, "--any-host", "--output", "json"}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("expect exit code 1, got %d, stderr: %s", code, stderr.String())
+	}
+	var report debugReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout.String(), "googletranstest") {
+		t.Errorf("expect no cookie value in: %s", stdout.String())
+	}
+	if report.Tk != sign || len(report.Cookies) != 1 || report.Cookies[0].Name != "NID" || report.Cookies[0].Expires == nil || len(report.Errors) != 1 || !strings.Contains(report.Errors["translation"], "blocked") {
+		t.Errorf("expect only the translation to be blocked, got: %+v", report)
+	}
+	if code := run([]string{"debug", "--service-url", srv.URL}, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("expect the default host policy to fail, got exit code %d", code)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mind1949/googletrans/internal/cli"
+)
+
+// errUsage means the flags are invalid, flag has already reported why
+var errUsage = errors.New("invalid usage")
+
+// defaultStateFile is the state file of commands keeping one by default
+func defaultStateFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "googletrans", "state.json")
+}
+
+// inputFlags are the flags saying where the texts of a command come from
+type inputFlags struct {
+	files cli.Strings
+}
+
+func (f *inputFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.files, "file", "`file` to read text from, can be repeated, - is stdin")
+}
+
+// texts returns the text of args, or of each file,
+// or of stdin if there are neither
+func (f *inputFlags) texts(args []string, stdin io.Reader) ([]string, error) {
+	if len(args) > 0 {
+		return []string{strings.Join(args, " ")}, nil
+	}
+	if len(f.files) == 0 {
+		f.files = cli.Strings{"-"}
+	}
+
+	texts := make([]string, 0, len(f.files))
+	for _, name := range f.files {
+		var (
+			data []byte
+			err  error
+		)
+		if name == "-" {
+			data, err = ioutil.ReadAll(stdin)
+		} else {
+			data, err = ioutil.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, strings.TrimRight(string(data), "\r\n"))
+	}
+	return texts, nil
+}
+
+// each calls f with stdin, or with each file in order
+func (f *inputFlags) each(stdin io.Reader, fn func(r io.Reader) error) error {
+	if len(f.files) == 0 {
+		return fn(stdin)
+	}
+	for _, name := range f.files {
+		if name == "-" {
+			if err := fn(stdin); err != nil {
+				return err
+			}
+			continue
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = fn(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newFlagSet initializes the flag set of command name
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: googletrans %s\n\nFlags:\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args into fs, reporting invalid flags as errUsage
+func parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return errUsage
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+// Command googletrans translates text and detects languages with google translate.
+//
+// Usage:
+//
+//	googletrans translate [flags] [text ...]
+//	googletrans detect [flags] [text ...]
+//	googletrans repl [flags]
+//	googletrans debug [flags]
+//
+// Text is read from the arguments, from the files given with --file,
+// or from stdin if there are neither.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: googletrans <command> [flags] [text ...]
+
+Commands:
+  translate  translate text from --src to --dest
+  detect     detect the language of text
+  repl       translate interactively
+  debug      check the service urls stage by stage
+
+Run "googletrans <command> -h" for the flags of a command.
+`
+
+// command runs a subcommand with its arguments
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+var commands = map[string]command{
+	"translate": runTranslate,
+	"detect":    runDetect,
+	"repl":      runRepl,
+	"debug":     runDebug,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+			fmt.Fprint(stdout, usage)
+			return 0
+		}
+		fmt.Fprintf(stderr, "googletrans: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	err := cmd(args[1:], stdin, stdout, stderr)
+	switch err {
+	case nil:
+		return 0
+	case flag.ErrHelp:
+		return 0
+	case errUsage:
+		return 2
+	}
+	fmt.Fprintf(stderr, "googletrans %s: %v\n", args[0], err)
+	return 1
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mind1949/googletrans/googletranstest"
+)
+
+// newTestServer starts a fake service upper-casing text
+func newTestServer() *googletranstest.Server {
+	return googletranstest.NewServer(googletranstest.WithTranslate(func(src, dest, text string) googletranstest.Translation {
+		return googletranstest.Translation{
+			Text:          strings.ToUpper(text),
+			Pronunciation: "/" + text + "/",
+			Src:           "en",
+			Confidence:    0.5,
+		}
+	}))
+}
+
+func TestRun(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	ioutil.WriteFile(a, []byte("from a\n"), 0644)
+	ioutil.WriteFile(b, []byte("from b\n"), 0644)
+
+	service := []string{"--service-url", srv.URL, "--any-host"}
+	cases := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{"args", []string{"translate", "--dest", "zh-CN", "hello", "world"}, "", 0, "HELLO WORLD\n"},
+		{"stdin", []string{"translate"}, "hello\nworld\n", 0, "HELLO\nWORLD\n"},
+		{"files", []string{"translate", "--file", a, "--file", b}, "", 0, "FROM A\nFROM B\n"},
+		{"pronunciation", []string{"translate", "--output", "pronunciation", "hello"}, "", 0, "/hello/\n"},
+		{
+			"json", []string{"translate", "--src", "en", "--dest", "fr", "--output", "json", "hello"}, "", 0,
+			`{"params":{"src":"en","dest":"fr","text":"hello"},"text":"HELLO","pronunciation":"/hello/"}` + "\n",
+		},
+		{"detect", []string{"detect", "hello"}, "", 0, "en\t0.50\n"},
+		{"detect json", []string{"detect", "--output", "json"}, "hello", 0, `{"lang":"en","confidence":0.5}` + "\n"},
+		{"unknown output", []string{"detect", "--output", "pronunciation", "hello"}, "", 1, ""},
+		{"missing file", []string{"translate", "--file", filepath.Join(dir, "missing")}, "", 1, ""},
+		{"unknown flag", []string{"translate", "--nope"}, "", 2, ""},
+		{"unknown command", []string{"nope"}, "", 2, ""},
+		{"no command", nil, "", 2, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args := c.args
+			if len(args) > 0 && commands[args[0]] != nil {
+				args = append(append([]string{args[0]}, service...), args[1:]...)
+			}
+			var stdout, stderr bytes.Buffer
+			code := run(args, strings.NewReader(c.stdin), &stdout, &stderr)
+			if code != c.code {
+				t.Errorf("expect exit code %d, got %d, stderr: %s", c.code, code, stderr.String())
+			}
+			if stdout.String() != c.stdout {
+				t.Errorf("expect stdout: %q, got: %q", c.stdout, stdout.String())
+			}
+		})
+	}
+}
+
+// readFunc is an adapter to allow the use of ordinary functions as io.Reader
+type readFunc func(p []byte) (int, error)
+
+func (f readFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestSaveStateError(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "cache")
+
+	// once the state is loaded, a file takes the place of its directory
+	read := false
+	stdin := readFunc(func(p []byte) (int, error) {
+		if read {
+			return 0, io.EOF
+		}
+		read = true
+		if err := ioutil.WriteFile(cache, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return copy(p, "hello\n"), nil
+	})
+	args := []string{"translate", "--service-url", srv.URL, "--any-host", "--state", filepath.Join(cache, "state.json"), "--lines"}
+	var stdout, stderr bytes.Buffer
+	if code := run(args, stdin, &stdout, &stderr); code != 1 {
+		t.Errorf("expect exit code 1, got %d, stderr: %s", code, stderr.String())
+	}
+	if stdout.String() != "HELLO\n" {
+		t.Errorf("expect stdout: %q, got: %q", "HELLO\n", stdout.String())
+	}
+}
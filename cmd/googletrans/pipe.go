@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pipeFlags are the flags of the line by line mode of translate
+type pipeFlags struct {
+	lines       bool
+	jsonl       bool
+	field       string
+	outputField string
+	concurrency int
+	batch       int
+}
+
+func (f *pipeFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.lines, "lines", false, "translate each line of the input, writing one line per line")
+	fs.BoolVar(&f.jsonl, "jsonl", false, "translate a field of each JSON Lines record, writing one record per line")
+	fs.StringVar(&f.field, "field", "text", "`name` of the field translated with --jsonl")
+	fs.StringVar(&f.outputField, "output-field", "", "`name` of the field the translation is written to with --jsonl (default --field)")
+	fs.IntVar(&f.concurrency, "concurrency", 4, "number of batches translated at the same time")
+	fs.IntVar(&f.batch, "batch", 16, "maximum number of lines translated by one request, joined with newlines")
+}
+
+func (f *pipeFlags) enabled() bool {
+	return f.lines || f.jsonl
+}
+
+// pipeResult is the output line of an input line,
+// or why it couldn't be translated
+type pipeResult struct {
+	line string
+	err  error
+}
+
+// pipeBatch translates a batch of input lines into a result per line
+type pipeBatch func(lines []string) []pipeResult
+
+// pipe writes a line to w for each line of r, in order, translating
+// batches of up to batch lines, up to concurrency batches at the same time,
+// lines failing to translate are written as they are and reported to stderr,
+// it stops reading and translating on the first error writing to w
+func pipe(r io.Reader, w, stderr io.Writer, concurrency, batch int, translate pipeBatch) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if batch < 1 {
+		batch = 1
+	}
+
+	type pending struct {
+		n     int // number of the first line
+		lines []string
+		out   chan []pipeResult
+	}
+	var (
+		queue   = make(chan *pending, concurrency) // in input order
+		jobs    = make(chan *pending)
+		done    = make(chan struct{}) // closed when writing failed
+		readErr error
+	)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for p := range jobs {
+				p.out <- translate(p.lines)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		defer close(queue)
+		br := bufio.NewReader(r)
+		for n := 1; ; {
+			lines, err := readBatch(br, batch)
+			if len(lines) > 0 {
+				p := &pending{n: n, lines: lines, out: make(chan []pipeResult, 1)}
+				n += len(lines)
+				select {
+				case queue <- p:
+				case <-done:
+					return
+				}
+				select {
+				case jobs <- p:
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+		}
+	}()
+
+	var (
+		bw     = bufio.NewWriter(w)
+		failed int
+	)
+	for p := range queue {
+		var err error
+		for i, res := range <-p.out {
+			if res.err != nil {
+				fmt.Fprintf(stderr, "line %d: %v\n", p.n+i, res.err)
+				res.line = p.lines[i]
+				failed++
+			}
+			if err == nil {
+				_, err = bw.WriteString(res.line + "\n")
+			}
+		}
+		if err == nil {
+			// don't hold back a batch while the next one is translated
+			err = bw.Flush()
+		}
+		if err != nil {
+			// the reader is gone, for example a closed pipe, stop translating for nobody
+			close(done)
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	switch {
+	case readErr != nil:
+		return readErr
+	case failed > 0:
+		return fmt.Errorf("%d lines failed to translate", failed)
+	}
+	return nil
+}
+
+// readBatch reads up to size lines from br, only waiting for the first one,
+// so that a batch doesn't hold back lines of a slow input
+func readBatch(br *bufio.Reader, size int) ([]string, error) {
+	var lines []string
+	for len(lines) < size {
+		if len(lines) > 0 && !lineBuffered(br) {
+			break
+		}
+		line, err := br.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+	return lines, nil
+}
+
+// lineBuffered reports whether br holds a whole line, which is read without blocking
+func lineBuffered(br *bufio.Reader) bool {
+	buf, _ := br.Peek(br.Buffered())
+	return bytes.IndexByte(buf, '\n') >= 0
+}
+
+// translateBatch translates texts with one request, joined with newlines,
+// blank texts are left as they are and texts of several lines are translated on their own,
+// so is every text if the translation doesn't have a line per text
+func translateBatch(texts []string, translate func(text string) (string, error)) ([]string, []error) {
+	var (
+		out    = make([]string, len(texts))
+		errs   = make([]error, len(texts))
+		joined []int // indexes of the texts sent joined
+	)
+	for i, text := range texts {
+		switch {
+		case strings.TrimSpace(text) == "":
+			out[i] = text
+		case strings.Contains(text, "\n"):
+			out[i], errs[i] = translate(text)
+		default:
+			joined = append(joined, i)
+		}
+	}
+
+	if len(joined) > 1 {
+		lines := make([]string, len(joined))
+		for j, i := range joined {
+			lines[j] = texts[i]
+		}
+		translated, err := translate(strings.Join(lines, "\n"))
+		if parts := strings.Split(translated, "\n"); err != nil || len(parts) == len(joined) {
+			for j, i := range joined {
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				out[i] = strings.TrimRight(parts[j], "\r")
+			}
+			return out, errs
+		}
+	}
+	// a single text, or lines merged or split by the translation
+	for _, i := range joined {
+		out[i], errs[i] = translate(texts[i])
+	}
+	return out, errs
+}
+
+// translateLines translates batches of lines of text
+func translateLines(translate func(text string) (string, error)) pipeBatch {
+	return func(lines []string) []pipeResult {
+		out, errs := translateBatch(lines, translate)
+		results := make([]pipeResult, len(lines))
+		for i := range lines {
+			// a line has to stay a line
+			results[i] = pipeResult{strings.NewReplacer("\r\n", " ", "\n", " ").Replace(out[i]), errs[i]}
+		}
+		return results
+	}
+}
+
+// translateRecords translates field of batches of JSON Lines records into outputField,
+// the other fields are kept as they are
+func translateRecords(field, outputField string, translate func(text string) (string, error)) pipeBatch {
+	return func(lines []string) []pipeResult {
+		var (
+			results = make([]pipeResult, len(lines))
+			texts   []string
+			records []int // indexes of the records whose field is translated
+		)
+		for i, line := range lines {
+			results[i].line = line
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			text, ok, err := recordField(line, field)
+			if err != nil {
+				results[i].err = err
+			} else if ok {
+				texts = append(texts, text)
+				records = append(records, i)
+			}
+		}
+
+		out, errs := translateBatch(texts, translate)
+		for j, i := range records {
+			if errs[j] != nil {
+				results[i].err = errs[j]
+				continue
+			}
+			value, err := marshal(out[j])
+			if err == nil {
+				var record []byte
+				record, err = setField([]byte(lines[i]), outputField, value)
+				results[i].line = string(record)
+			}
+			results[i].err = err
+		}
+		return results
+	}
+}
+
+// recordField returns field of the JSON Lines record line,
+// ok is false if the record has no such field
+func recordField(line, field string) (text string, ok bool, err error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return "", false, err
+	}
+	raw, ok := record[field]
+	if !ok {
+		return "", false, nil
+	}
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return "", false, fmt.Errorf("field %s isn't a string", field)
+	}
+	return text, true, nil
+}
+
+// setField sets field of the json object record to value, in place if record has it,
+// last otherwise, so that the fields keep their order
+func setField(record []byte, field string, value []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(record))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var fields int
+	for ; dec.More(); fields++ {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start := dec.InputOffset() // right after the key, before the colon
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if key == field {
+			out := append(append([]byte{}, record[:start]...), ':')
+			out = append(out, value...)
+			return append(out, record[dec.InputOffset():]...), nil
+		}
+	}
+
+	end := bytes.LastIndexByte(record, '}')
+	name, err := marshal(field)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, record[:end]...)
+	if fields > 0 {
+		out = append(out, ',')
+	}
+	out = append(append(append(out, name...), ':'), value...)
+	return append(out, record[end:]...), nil
+}
+
+// marshal encodes v as json on a single line without escaping html characters
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/googletranstest"
+)
+
+func TestPipe(t *testing.T) {
+	srv := googletranstest.NewServer(googletranstest.WithTranslate(func(src, dest, text string) googletranstest.Translation {
+		// finish out of order
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		return googletranstest.Translation{Text: strings.ToUpper(text), Src: "en", Confidence: 1}
+	}))
+	defer srv.Close()
+	service := []string{"--service-url", srv.URL, "--any-host"}
+
+	var in, expect strings.Builder
+	for i := 0; i < 100; i++ {
+		if i%10 == 0 {
+			in.WriteString("\n")
+			expect.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(&in, "line %d\r\n", i)
+		fmt.Fprintf(&expect, "LINE %d\n", i)
+	}
+
+	cases := []struct {
+		name   string
+		args   []string
+		fault  googletranstest.Fault
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{"lines", []string{"--lines", "--concurrency", "8", "--batch", "4"}, 0, in.String(), 0, expect.String()},
+		{"a request per line", []string{"--lines", "--batch", "1"}, 0, in.String(), 0, expect.String()},
+		{"no trailing newline", []string{"--lines"}, 0, "a\nb", 0, "A\nB\n"},
+		{"json lines", []string{"--lines", "--output", "json"}, 0, "a\n", 0, `{"params":{"src":"auto","dest":"en","text":"a"},"text":"A","pronunciation":""}` + "\n"},
+		{"failed line", []string{"--lines", "--concurrency", "1", "--batch", "1"}, googletranstest.MalformedJSON, "a\nb\n", 1, "a\nB\n"},
+		{"failed batch", []string{"--lines", "--concurrency", "1"}, googletranstest.MalformedJSON, "a\nb\n", 1, "a\nb\n"},
+		{
+			"jsonl", []string{"--jsonl"}, 0,
+			`{"id":1,"text":"<a>"}` + "\n" + `{"id":2}` + "\n" + "\n",
+			0,
+			`{"id":1,"text":"<A>"}` + "\n" + `{"id":2}` + "\n" + "\n",
+		},
+		{
+			"jsonl output field", []string{"--jsonl", "--field", "msg", "--output-field", "msg_en"}, 0,
+			`{"msg":"hi","level":"info"}` + "\n" + `not json` + "\n" + `{"msg":1}` + "\n",
+			1,
+			`{"msg":"hi","level":"info","msg_en":"HI"}` + "\n" + `not json` + "\n" + `{"msg":1}` + "\n",
+		},
+		{"lines and jsonl", []string{"--lines", "--jsonl"}, 0, "", 1, ""},
+		{"arguments", []string{"--lines", "hello"}, 0, "", 1, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.fault != 0 {
+				srv.Inject(c.fault)
+			}
+			args := append(append([]string{"translate"}, service...), c.args...)
+			var stdout, stderr bytes.Buffer
+			code := run(args, strings.NewReader(c.stdin), &stdout, &stderr)
+			if code != c.code {
+				t.Errorf("expect exit code %d, got %d, stderr: %s", c.code, code, stderr.String())
+			}
+			if stdout.String() != c.stdout {
+				t.Errorf("expect stdout: %q, got: %q", c.stdout, stdout.String())
+			}
+		})
+	}
+}
+
+// endless is an input of endless lines
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = "a\n"[i%2]
+	}
+	return len(p), nil
+}
+
+// brokenPipe fails every write like a closed pipe
+type brokenPipe struct{}
+
+func (brokenPipe) Write([]byte) (int, error) {
+	return 0, syscall.EPIPE
+}
+
+func TestPipeWriteError(t *testing.T) {
+	var translated int64
+	errc := make(chan error, 1)
+	go func() {
+		errc <- pipe(endless{}, brokenPipe{}, ioutil.Discard, 4, 16, func(lines []string) []pipeResult {
+			atomic.AddInt64(&translated, int64(len(lines)))
+			return make([]pipeResult, len(lines))
+		})
+	}()
+
+	select {
+	case err := <-errc:
+		if err != syscall.EPIPE {
+			t.Errorf("expect EPIPE, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipe kept translating after failing to write")
+	}
+	time.Sleep(10 * time.Millisecond)
+	// the batches queued, being translated, written and read
+	if n := atomic.LoadInt64(&translated); n > (4+4+2)*16 {
+		t.Errorf("expect at most the batches read ahead to be translated, got %d lines", n)
+	}
+}
+
+func TestTranslateBatch(t *testing.T) {
+	errFailed := errors.New("failed")
+	cases := []struct {
+		name      string
+		translate func(text string) (string, error)
+		texts     []string
+		requests  int
+		out       []string
+		err       error
+	}{
+		{"joined", func(text string) (string, error) { return strings.ToUpper(text), nil }, []string{"a", "", "b", " "}, 1, []string{"A", "", "B", " "}, nil},
+		{"several lines", func(text string) (string, error) { return strings.ToUpper(text), nil }, []string{"a", "b\nc", "d"}, 2, []string{"A", "B\nC", "D"}, nil},
+		{"lines merged", func(text string) (string, error) { return strings.Replace(strings.ToUpper(text), "\n", " ", -1), nil }, []string{"a", "b", "c"}, 4, []string{"A", "B", "C"}, nil},
+		{"failed", func(text string) (string, error) { return "", errFailed }, []string{"a", "", "b"}, 1, []string{"", "", ""}, errFailed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var requests int
+			out, errs := translateBatch(c.texts, func(text string) (string, error) {
+				requests++
+				return c.translate(text)
+			})
+			if requests != c.requests {
+				t.Errorf("expect %d requests, got %d", c.requests, requests)
+			}
+			if !reflect.DeepEqual(out, c.out) {
+				t.Errorf("expect: %q, got: %q", c.out, out)
+			}
+			for i, err := range errs {
+				if blank := strings.TrimSpace(c.texts[i]) == ""; blank && err != nil || !blank && err != c.err {
+					t.Errorf("text %d: expect error %v, got: %v", i, c.err, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSetField(t *testing.T) {
+	cases := []struct {
+		record string
+		field  string
+		expect string
+	}{
+		{`{"b":1,"text":"hi","a":2}`, "text", `{"b":1,"text":"HI","a":2}`},
+		{`{ "b" : 1, "text" : "hi" , "a":{"text":0} }`, "text", `{ "b" : 1, "text":"HI" , "a":{"text":0} }`},
+		{`{"b":1,"a":2}`, "text", `{"b":1,"a":2,"text":"HI"}`},
+		{`{}`, "text", `{"text":"HI"}`},
+	}
+	for _, c := range cases {
+		got, err := setField([]byte(c.record), c.field, []byte(`"HI"`))
+		if err != nil || string(got) != c.expect {
+			t.Errorf("set %s of %s: expect %s, got: %s, %v", c.field, c.record, c.expect, got, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mind1949/googletrans"
+	"github.com/mind1949/googletrans/internal/cli"
+)
+
+const replHelp = `Type text to translate it, or a command:
+  :src <language>   set the source language, auto to detect it
+  :dest <language>  set the destination language
+  :swap             swap the source and destination languages
+  :pron             toggle the pronunciation
+  :dict             toggle the dictionary
+  :help             show this help
+  :quit             quit, like end of input
+`
+
+// repl is the session of the repl command
+type repl struct {
+	translator    *googletrans.Translator
+	src, dest     string
+	pronunciation bool
+	dictionary    bool
+	detected      googletrans.Detected // of the last translation
+}
+
+func runRepl(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	var (
+		fs = newFlagSet("repl", "repl [flags]", stderr)
+		tf = cli.TranslatorFlags{State: defaultStateFile()}
+		r  repl
+	)
+	fs.StringVar(&r.src, "src", "auto", "source `language`")
+	fs.StringVar(&r.dest, "dest", "en", "destination `language`")
+	fs.BoolVar(&r.pronunciation, "pron", false, "show the pronunciation")
+	fs.BoolVar(&r.dictionary, "dict", false, "show the dictionary")
+	tf.Register(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	translator, err := tf.Translator()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := tf.Close(translator); e != nil && err == nil {
+			err = e
+		}
+	}()
+	r.translator = translator
+	// translations carry no detection, keep the one of the call
+	translator.Use(func(next googletrans.Handler) googletrans.Handler {
+		return googletrans.HandlerFunc(func(ctx context.Context, params googletrans.TranslateParams) (googletrans.Result, error) {
+			result, err := next.Handle(ctx, params)
+			r.detected = result.Detected
+			return result, err
+		})
+	})
+
+	fmt.Fprint(stdout, replHelp)
+	scanner := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprintf(stdout, "%s>%s> ", r.src, r.dest)
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case line == ":quit" || line == ":q":
+			return nil
+		case strings.HasPrefix(line, ":"):
+			if err := r.command(line, stdout); err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+			}
+		default:
+			if err := r.translate(line, stdout); err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+			}
+		}
+	}
+}
+
+// command runs a repl command
+func (r *repl) command(line string, stdout io.Writer) error {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":src", ":dest":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: %s <language>", fields[0])
+		}
+		if fields[0] == ":src" {
+			r.src = fields[1]
+		} else {
+			r.dest = fields[1]
+		}
+	case ":swap":
+		if r.src == "auto" {
+			return fmt.Errorf("can't translate to auto, set :src first")
+		}
+		r.src, r.dest = r.dest, r.src
+	case ":pron":
+		r.pronunciation = !r.pronunciation
+		fmt.Fprintf(stdout, "pronunciation %s\n", onOff(r.pronunciation))
+	case ":dict":
+		r.dictionary = !r.dictionary
+		fmt.Fprintf(stdout, "dictionary %s\n", onOff(r.dictionary))
+	case ":help":
+		fmt.Fprint(stdout, replHelp)
+	default:
+		return fmt.Errorf("unknown command %s, type :help", fields[0])
+	}
+	return nil
+}
+
+// translate translates text and prints it with the detected language
+func (r *repl) translate(text string, stdout io.Writer) error {
+	translated, dictionary, err := r.translator.TranslateDictionary(googletrans.TranslateParams{
+		Src:  r.src,
+		Dest: r.dest,
+		Text: text,
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.src == "auto" {
+		fmt.Fprintf(stdout, "[%s %.2f] ", r.detected.Lang, r.detected.Confidence)
+	}
+	fmt.Fprintln(stdout, translated.Text)
+	if r.pronunciation && translated.Pronunciation != "" {
+		fmt.Fprintf(stdout, "  %s\n", translated.Pronunciation)
+	}
+	if r.dictionary {
+		for _, entry := range dictionary {
+			fmt.Fprintf(stdout, "  %s: %s\n", entry.PartOfSpeech, strings.Join(entry.Terms, ", "))
+		}
+	}
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mind1949/googletrans/googletranstest"
+)
+
+func TestRepl(t *testing.T) {
+	srv := googletranstest.NewServer(googletranstest.WithTranslate(func(src, dest, text string) googletranstest.Translation {
+		return googletranstest.Translation{
+			Text:          dest + ":" + text,
+			Pronunciation: "/" + text + "/",
+			Src:           "en",
+			Confidence:    0.9,
+			Dictionary: []googletranstest.DictionaryEntry{
+				{PartOfSpeech: "noun", Terms: []string{"a", "b"}},
+			},
+		}
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state := filepath.Join(dir, "cache", "state.json")
+
+	script := strings.Join([]string{
+		"hello",
+		":dest fr",
+		":pron",
+		":dict",
+		"hello",
+		":swap",
+		":src en",
+		":swap",
+		"hello",
+		":nope",
+		"",
+		":quit",
+		"not translated",
+	}, "\n")
+	expect := replHelp +
+		"auto>en> [en 0.90] en:hello\n" +
+		"auto>en> " +
+		"auto>fr> pronunciation on\n" +
+		"auto>fr> dictionary on\n" +
+		"auto>fr> [en 0.90] fr:hello\n  /hello/\n  noun: a, b\n" +
+		"auto>fr> " +
+		"auto>fr> " +
+		"en>fr> " +
+		"fr>en> en:hello\n  /hello/\n  noun: a, b\n" +
+		"fr>en> " +
+		"fr>en> " +
+		"fr>en> "
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"repl", "--service-url", srv.URL, "--any-host", "--state", state}
+	if code := run(args, strings.NewReader(script), &stdout, &stderr); code != 0 {
+		t.Errorf("expect exit code 0, got %d, stderr: %s", code, stderr.String())
+	}
+	if stdout.String() != expect {
+		t.Errorf("expect stdout:\n%s\ngot:\n%s", expect, stdout.String())
+	}
+	if expect := "error: can't translate to auto, set :src first\nerror: unknown command :nope, type :help\n"; stderr.String() != expect {
+		t.Errorf("expect stderr:\n%s\ngot:\n%s", expect, stderr.String())
+	}
+	if _, err := os.Stat(state); err != nil {
+		t.Errorf("expect the state to be saved: %v", err)
+	}
+}
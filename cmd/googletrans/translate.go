@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mind1949/googletrans"
+	"github.com/mind1949/googletrans/internal/cli"
+)
+
+// output formats
+const (
+	outputText          = "text"
+	outputPronunciation = "pronunciation"
+	outputJSON          = "json"
+)
+
+func runTranslate(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	var (
+		fs     = newFlagSet("translate", "translate [flags] [text ...]", stderr)
+		tf     cli.TranslatorFlags
+		inputs inputFlags
+		pf     pipeFlags
+		src    = fs.String("src", "auto", "source `language`")
+		dest   = fs.String("dest", "en", "destination `language`")
+		output = fs.String("output", outputText, "output `format`: text, pronunciation or json")
+	)
+	tf.Register(fs)
+	inputs.register(fs)
+	pf.register(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputPronunciation && *output != outputJSON {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	if pf.lines && pf.jsonl {
+		return errors.New("--lines and --jsonl can't be used together")
+	}
+	if pf.enabled() && fs.NArg() > 0 {
+		return errors.New("--lines and --jsonl read stdin or --file, not arguments")
+	}
+
+	translator, err := tf.Translator()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := tf.Close(translator); e != nil && err == nil {
+			err = e
+		}
+	}()
+	translate := func(text string) (string, error) {
+		translated, err := translator.TranslateContext(context.Background(), googletrans.TranslateParams{
+			Src:  *src,
+			Dest: *dest,
+			Text: text,
+		})
+		if err != nil {
+			return "", err
+		}
+		return format(translated, *output)
+	}
+
+	if pf.enabled() {
+		batch := pf.batch
+		lines := translateLines(translate)
+		if !pf.jsonl && *output != outputText {
+			// a pronunciation or a json document per line takes a request per line
+			batch = 1
+		}
+		if pf.jsonl {
+			outputField := pf.outputField
+			if outputField == "" {
+				outputField = pf.field
+			}
+			// records get the translated text whatever the output format
+			lines = translateRecords(pf.field, outputField, func(text string) (string, error) {
+				translated, err := translator.TranslateContext(context.Background(), googletrans.TranslateParams{
+					Src:  *src,
+					Dest: *dest,
+					Text: text,
+				})
+				return translated.Text, err
+			})
+		}
+		return inputs.each(stdin, func(r io.Reader) error {
+			return pipe(r, stdout, stderr, pf.concurrency, batch, lines)
+		})
+	}
+
+	texts, err := inputs.texts(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	for _, text := range texts {
+		out, err := translate(text)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, out)
+	}
+	return nil
+}
+
+// format formats translated in output format
+func format(translated googletrans.Translated, output string) (string, error) {
+	switch output {
+	case outputPronunciation:
+		return translated.Pronunciation, nil
+	case outputJSON:
+		data, err := marshal(translated)
+		return string(data), err
+	}
+	return translated.Text, nil
+}
+
+func runDetect(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	var (
+		fs     = newFlagSet("detect", "detect [flags] [text ...]", stderr)
+		tf     cli.TranslatorFlags
+		inputs inputFlags
+		output = fs.String("output", outputText, "output `format`: text or json")
+	)
+	tf.Register(fs)
+	inputs.register(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	texts, err := inputs.texts(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	translator, err := tf.Translator()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := tf.Close(translator); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	for _, text := range texts {
+		detected, err := translator.DetectContext(context.Background(), text)
+		if err != nil {
+			return err
+		}
+		switch *output {
+		case outputText:
+			fmt.Fprintf(stdout, "%s\t%.2f\n", detected.Lang, detected.Confidence)
+		case outputJSON:
+			if err = json.NewEncoder(stdout).Encode(detected); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package googletrans
+
+import (
+	"os"
+	"time"
+)
+
+// staleLock is how long a lock file must be left untouched to be considered
+// abandoned, holders touch it every staleLock/4 however long they hold it
+const staleLock = 10 * time.Second
+
+// lockFile creates the file name exclusively, waiting while it exists
+func lockFile(name string) (unlock func() error, err error) {
+	for {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return holdLock(name), nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if stale(name) {
+			breakLock(name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stale reports whether the lock file name was abandoned
+func stale(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && time.Since(info.ModTime()) > staleLock
+}
+
+// breakLock removes the lock file name if it's still stale while holding name+".break",
+// so that a process that saw the stale lock can't remove the fresh one taken after
+// another process removed it: only break holders remove the locks of others,
+// one at a time, and a fresh lock isn't stale
+func breakLock(name string) {
+	brk := name + ".break"
+	f, err := os.OpenFile(brk, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		// it's held for a stat, a stale one was left by a process that died holding it
+		if stale(brk) {
+			os.Remove(brk)
+		}
+		return
+	}
+	f.Close()
+	defer os.Remove(brk)
+	if stale(name) {
+		os.Remove(name)
+	}
+}
+
+// holdLock keeps the lock file name fresh until unlock removes it,
+// so that a slow holder isn't taken for an abandoned one
+func holdLock(name string) (unlock func() error) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(staleLock / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				os.Chtimes(name, now, now)
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		<-stopped
+		return os.Remove(name)
+	}
+}
@@ -0,0 +1,125 @@
+package googletrans
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+// FileStore is a StateStore kept in a json file on local disk,
+// every access locks name+".lock" so that the processes of one machine,
+// or the pods mounting one volume, can share it
+type FileStore struct {
+	name string
+}
+
+// fileState is the content of a FileStore's file
+type fileState struct {
+	Tkk      map[string]string              `json:"tkk"`
+	Cookies  map[string][]transcookie.Entry `json:"cookies"`
+	Counters map[string]*counter            `json:"counters"`
+}
+
+// newFileState returns the content of an empty file
+func newFileState() fileState {
+	return fileState{
+		Tkk:      make(map[string]string),
+		Cookies:  make(map[string][]transcookie.Entry),
+		Counters: make(map[string]*counter),
+	}
+}
+
+// NewFileStore initializes a FileStore kept in the file name
+func NewFileStore(name string) *FileStore {
+	return &FileStore{name: name}
+}
+
+// LoadTkk returns the tkk stored for serviceURL
+func (s *FileStore) LoadTkk(serviceURL string) (tkk string, ok bool, err error) {
+	err = s.update(false, func(state *fileState) {
+		tkk, ok = state.Tkk[serviceURL]
+	})
+	return tkk, ok, err
+}
+
+// StoreTkk stores serviceURL's tkk
+func (s *FileStore) StoreTkk(serviceURL, tkk string) error {
+	return s.update(true, func(state *fileState) {
+		state.Tkk[serviceURL] = tkk
+	})
+}
+
+// LoadCookies returns the cookies stored for serviceURL
+func (s *FileStore) LoadCookies(serviceURL string) (cookies []transcookie.Entry, err error) {
+	err = s.update(false, func(state *fileState) {
+		cookies = state.Cookies[serviceURL]
+	})
+	return cookies, err
+}
+
+// StoreCookies replaces the cookies stored for serviceURL
+func (s *FileStore) StoreCookies(serviceURL string, cookies []transcookie.Entry) error {
+	return s.update(true, func(state *fileState) {
+		state.Cookies[serviceURL] = cookies
+	})
+}
+
+// Incr increments the counter key of the current fixed window
+func (s *FileStore) Incr(key string, window time.Duration) (n int64, err error) {
+	err = s.update(true, func(state *fileState) {
+		c, ok := state.Counters[key]
+		if !ok {
+			c = &counter{}
+			state.Counters[key] = c
+		}
+		n = c.incr(time.Now(), window)
+	})
+	return n, err
+}
+
+// update calls f with the file's content while holding the lock,
+// and writes the content back if write is true
+func (s *FileStore) update(write bool, f func(state *fileState)) error {
+	unlock, err := lockFile(s.name + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := ioutil.ReadFile(s.name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	state := newFileState()
+	if len(data) > 0 && json.Unmarshal(data, &state) != nil {
+		// a corrupted file holds nothing worth keeping, the next write replaces it
+		state = newFileState()
+	}
+
+	f(&state)
+	if !write {
+		return nil
+	}
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.name), filepath.Base(s.name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.name)
+}
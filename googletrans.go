@@ -2,17 +2,22 @@ package googletrans
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"text/scanner"
 	"time"
 
-	"github.com/mind1949/googletrans/tk"
+	"github.com/mind1949/googletrans/pseudo"
 	"github.com/mind1949/googletrans/tkk"
 	"github.com/mind1949/googletrans/transcookie"
 )
@@ -27,6 +32,9 @@ var (
 	emptyRawTranslated = rawTranslated{}
 
 	defaultTranslator = New()
+
+	// ErrMalformed means the translation result couldn't be parsed
+	ErrMalformed = errors.New("malformed translation result")
 )
 
 // Translate uses defaultTranslator to translate params.text
@@ -58,6 +66,12 @@ type Translated struct {
 	Pronunciation string          `json:"pronunciation"` // pronunciation of translated text
 }
 
+// DictionaryEntry represents the translations of a word as a part of speech
+type DictionaryEntry struct {
+	PartOfSpeech string   `json:"pos"`
+	Terms        []string `json:"terms"`
+}
+
 // Detected represents language detection result
 type Detected struct {
 	Lang       string  `json:"lang"`       // detected language
@@ -68,6 +82,7 @@ type rawTranslated struct {
 	translated struct {
 		text          string
 		pronunciation string
+		dictionary    []DictionaryEntry
 	}
 	detected struct {
 		originalLanguage string
@@ -77,9 +92,93 @@ type rawTranslated struct {
 
 // Translator is responsible for translation
 type Translator struct {
-	clt         *http.Client
+	clt      *http.Client
+	signer   Signer
+	newCache func(serviceURL string) tkk.Cache
+	jar      http.CookieJar
+	policy   transcookie.HostPolicy
+	store    StateStore
+	counters StateStore    // counts requests for the rate limit
+	limit    int64         // requests per window and service host, 0 for no limit
+	window   time.Duration // rate limit window
+
+	health health
+
+	direct      *route
+	proxies     []*url.URL
+	routes      []*route      // proxy routes, requests go direct if there are none
+	ejection    time.Duration // how long blocked or failing proxies are left out
+	proxyHealth health
+
+	localAddrs []net.IP
+	rotation   Rotation
+
+	pseudo *pseudo.Localizer // pseudo-localizes instead of translating if set
+
+	m           sync.RWMutex
 	serviceURLs []string
-	tkkCache    tkk.Cache
+	middlewares []func(next Handler) Handler
+	handler     Handler // t.handle wrapped in middlewares
+}
+
+// Option configures a Translator
+type Option func(*Translator)
+
+// WithServiceURLs sets the service urls of a Translator,
+// unlike New, the default service url isn't added
+func WithServiceURLs(serviceURLs ...string) Option {
+	return func(t *Translator) {
+		t.serviceURLs = serviceURLs
+	}
+}
+
+// WithClient sets the client requests that don't go through a proxy are sent with,
+// for example one whose Transport is a googletranstest.Recorder,
+// WithLocalAddrs doesn't apply to it
+func WithClient(clt *http.Client) Option {
+	return func(t *Translator) {
+		t.clt = clt
+	}
+}
+
+// WithTkkCache sets how the tkk cache of each service url is created
+func WithTkkCache(newCache func(serviceURL string) tkk.Cache) Option {
+	return func(t *Translator) {
+		t.newCache = newCache
+	}
+}
+
+// WithTkk makes all service urls share cache,
+// for example: WithTkk(tkk.Static("443916.547221231"))
+func WithTkk(cache tkk.Cache) Option {
+	return WithTkkCache(func(string) tkk.Cache {
+		return cache
+	})
+}
+
+// WithSigner sets how translation requests are signed,
+// by default they carry the tk computed from each service url's tkk
+func WithSigner(signer Signer) Option {
+	return func(t *Translator) {
+		t.signer = signer
+	}
+}
+
+// WithCookieJar sets the jar the cookies of service urls are kept in,
+// by default every Translator has its own transcookie.Jar
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(t *Translator) {
+		t.jar = jar
+	}
+}
+
+// WithHostPolicy sets which service hosts a Translator may talk to,
+// by default only google translation hosts are allowed,
+// for example: WithHostPolicy(transcookie.AllowHosts("translate.example.com"))
+func WithHostPolicy(policy transcookie.HostPolicy) Option {
+	return func(t *Translator) {
+		t.policy = policy
+	}
 }
 
 // New initializes a Translator
@@ -95,34 +194,90 @@ func New(serviceURLs ...string) *Translator {
 		serviceURLs = append(serviceURLs, defaultServiceURL)
 	}
 
-	return &Translator{
-		clt:         &http.Client{},
-		serviceURLs: serviceURLs,
-		tkkCache:    tkk.NewCache(random(serviceURLs)),
+	return NewWithOptions(WithServiceURLs(serviceURLs...))
+}
+
+// NewWithOptions initializes a Translator with opts
+func NewWithOptions(opts ...Option) *Translator {
+	t := &Translator{
+		ejection: 10 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if len(t.serviceURLs) == 0 {
+		t.serviceURLs = []string{defaultServiceURL}
+	}
+	if t.store != nil {
+		t.counters = t.store
+	} else if t.limit > 0 {
+		t.counters = NewMemoryStore()
+	}
+	if t.jar == nil {
+		t.jar = transcookie.NewJar()
+	}
+	if t.policy == nil {
+		t.policy = transcookie.GoogleHosts
+	}
+	t.direct = t.newRoute(t.clt, t.jar)
+	t.clt = t.direct.clt
+	for _, proxy := range t.proxies {
+		t.routes = append(t.routes, t.newProxyRoute(proxy, nil, transcookie.NewJar()))
 	}
+
+	return t
+}
+
+// Close stops the background work of t's tkk caches
+// and closes the idle connections t opened
+func (t *Translator) Close() error {
+	err := t.direct.close()
+	for _, r := range t.routes {
+		if e := r.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
 // Translate translates text from src language to dest language
 func (t *Translator) Translate(params TranslateParams) (Translated, error) {
+	return t.TranslateContext(context.Background(), params)
+}
+
+// TranslateContext is like Translate but gives up when ctx is done
+func (t *Translator) TranslateContext(ctx context.Context, params TranslateParams) (Translated, error) {
+	translated, _, err := t.TranslateDictionaryContext(ctx, params)
+	return translated, err
+}
+
+// TranslateDictionary is like Translate but also returns the dictionary,
+// which google only gives for a single word
+func (t *Translator) TranslateDictionary(params TranslateParams) (Translated, []DictionaryEntry, error) {
+	return t.TranslateDictionaryContext(context.Background(), params)
+}
+
+// TranslateDictionaryContext is like TranslateDictionary but gives up when ctx is done
+func (t *Translator) TranslateDictionaryContext(ctx context.Context, params TranslateParams) (Translated, []DictionaryEntry, error) {
 	if params.Src == "" {
 		params.Src = "auto"
 	}
 
-	transData, err := t.do(params)
+	result, err := t.getHandler().Handle(ctx, params)
 	if err != nil {
-		return emptyTranlated, err
+		return emptyTranlated, nil, err
 	}
-
-	return Translated{
-		Params:        params,
-		Text:          transData.translated.text,
-		Pronunciation: transData.translated.pronunciation,
-	}, nil
+	return result.Translated, result.Dictionary, nil
 }
 
 // Detect detects text's language
 func (t *Translator) Detect(text string) (Detected, error) {
-	transData, err := t.do(TranslateParams{
+	return t.DetectContext(context.Background(), text)
+}
+
+// DetectContext is like Detect but gives up when ctx is done
+func (t *Translator) DetectContext(ctx context.Context, text string) (Detected, error) {
+	result, err := t.getHandler().Handle(ctx, TranslateParams{
 		Src:  "auto",
 		Dest: "en",
 		Text: text,
@@ -130,52 +285,108 @@ func (t *Translator) Detect(text string) (Detected, error) {
 	if err != nil {
 		return emptyDetected, err
 	}
-	return Detected{
-		Lang:       transData.detected.originalLanguage,
-		Confidence: transData.detected.confidence,
-	}, nil
+	return result.Detected, nil
 }
 
-func (t *Translator) do(params TranslateParams) (rawTranslated, error) {
-	req, err := t.buildTransRequest(params)
+func (t *Translator) do(ctx context.Context, params TranslateParams) (rawTranslated, error) {
+	if t.pseudo != nil {
+		return t.pseudoTranslate(params), nil
+	}
+	serviceURL, err := t.randomServiceURL()
 	if err != nil {
 		return emptyRawTranslated, err
 	}
-
-	transService := req.URL.Scheme + "://" + req.URL.Hostname()
-	var resp *http.Response
+	transService := serviceHost(serviceURL)
+	var (
+		resp *http.Response
+		data []byte
+	)
 	for try := 0; try < 3; try++ {
-		cookie, err := transcookie.Get(transService)
+		// only the last try's response is reported
+		resp, data = nil, nil
+		var r *route
+		r, err = t.route()
 		if err != nil {
 			return emptyRawTranslated, err
 		}
-		req.AddCookie(&cookie)
-		resp, err = t.clt.Do(req)
+		var (
+			cookies []*http.Cookie
+			req     *http.Request
+		)
+		cookies, err = r.getCookies(ctx, transService)
+		if err == nil {
+			req, err = t.buildTransRequest(r, transService, params)
+		}
+		if errors.Is(err, errCaptcha) {
+			err = t.blocked(r, transService, nil)
+			if r.proxy != nil {
+				continue
+			}
+			return emptyRawTranslated, err
+		}
+		if err != nil {
+			if r.proxy != nil && ctx.Err() == nil && transportError(err) {
+				// the proxy may be down, try another one
+				t.eject(r)
+				continue
+			}
+			return emptyRawTranslated, err
+		}
+		req = req.WithContext(ctx)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if err = t.allow(transService); err != nil {
+			return emptyRawTranslated, err
+		}
+		resp, err = r.clt.Do(req)
+		if err == nil {
+			data, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if errors.Is(err, errCaptcha) || err == nil && isBlocked(resp, data) {
+			err = t.blocked(r, transService, resp)
+			resp = nil
+			if r.proxy != nil {
+				continue
+			}
+			return emptyRawTranslated, err
+		}
 		if err != nil {
+			t.health.failure(transService, 0)
+			if r.proxy != nil && ctx.Err() == nil {
+				// the proxy may be down, try another one
+				t.eject(r)
+				continue
+			}
 			return emptyRawTranslated, err
 		}
 
 		if resp.StatusCode == http.StatusOK {
+			t.health.success(transService)
+			t.proxySuccess(r)
 			break
 		}
+		t.health.failure(transService, resp.StatusCode)
 
-		if resp.StatusCode == http.StatusTooManyRequests {
-			_, err = transcookie.Update(transService, 3*time.Second)
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			err = r.updateCookies(ctx, transService, 3*time.Second)
 			if err != nil {
 				return emptyRawTranslated, err
 			}
+		case http.StatusForbidden:
+			// the service rejected tk, its tkk is most likely stale
+			r.invalidateTkk(transService)
 		}
 	}
+	if resp == nil {
+		return emptyRawTranslated, err
+	}
 	if resp.StatusCode != http.StatusOK {
 		return emptyRawTranslated, fmt.Errorf("failed to get translation result, err: %s", resp.Status)
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return emptyRawTranslated, err
-	}
-	resp.Body.Close()
-
 	result, err := t.parseRawTranslated(data)
 	if err != nil {
 		return emptyRawTranslated, err
@@ -184,14 +395,8 @@ func (t *Translator) do(params TranslateParams) (rawTranslated, error) {
 	return result, nil
 }
 
-func (t *Translator) buildTransRequest(params TranslateParams) (request *http.Request, err error) {
-	tkk, err := t.tkkCache.Get()
-	if err != nil {
-		return nil, err
-	}
-	tk, _ := tk.Get(params.Text, tkk)
-
-	u, err := url.Parse(t.randomServiceURL() + "/translate_a/single")
+func (t *Translator) buildTransRequest(r *route, serviceURL string, params TranslateParams) (request *http.Request, err error) {
+	u, err := url.Parse(serviceURL + "/translate_a/single")
 	if err != nil {
 		return nil, err
 	}
@@ -211,10 +416,12 @@ func (t *Translator) buildTransRequest(params TranslateParams) (request *http.Re
 		"ssel":   "0",
 		"tsel":   "0",
 		"kc":     "7",
-		"tk":     tk,
 	} {
 		queries.Add(k, v)
 	}
+	if err = r.signer.Sign(serviceURL, params.Text, queries); err != nil {
+		return nil, err
+	}
 	dts := []string{"at", "bd", "ex", "ld", "md", "qca", "rw", "rm", "ss", "t"}
 	for i := 0; i < len(dts); i++ {
 		queries.Add("dt", dts[i])
@@ -249,55 +456,132 @@ func (*Translator) parseRawTranslated(data []byte) (result rawTranslated, err er
 	var (
 		coord       = []int{-1}
 		textBuilder strings.Builder
+		errs        int
 	)
+	s.Error = func(_ *scanner.Scanner, msg string) {
+		// json escapes go doesn't know, like \/, are decoded by unquote
+		if msg != "invalid char escape" {
+			errs++
+		}
+	}
 	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
 		switch tok {
 		case '[':
 			coord[len(coord)-1]++
 			coord = append(coord, -1)
 		case ']':
+			if len(coord) == 1 {
+				return emptyRawTranslated, ErrMalformed
+			}
 			coord = coord[:len(coord)-1]
 		case ',':
 			// no-op
 		default:
 			tokText := s.TokenText()
 			coord[len(coord)-1]++
+			var err error // a string was expected but tokText isn't one
 
 			if len(coord) == 4 && coord[1] == 0 && coord[3] == 0 {
 				if tokText != "null" {
-					textBuilder.WriteString(tokText[1 : len(tokText)-1])
+					var text string
+					text, err = unquote(tokText)
+					textBuilder.WriteString(text)
 				}
 			}
 			if len(coord) == 4 && coord[0] == 0 && coord[1] == 0 && coord[2] == 1 && coord[3] == 2 {
 				if tokText != "null" {
-					result.translated.pronunciation = tokText[1 : len(tokText)-1]
+					result.translated.pronunciation, err = unquote(tokText)
 				}
 			}
 			if len(coord) == 4 && coord[0] == 0 && coord[1] == 0 && coord[3] == 2 {
 				if tokText != "null" {
-					result.translated.pronunciation = tokText[1 : len(tokText)-1]
+					result.translated.pronunciation, err = unquote(tokText)
 				}
 			}
+			// data[1] is the dictionary: [[pos, [term, ...], ...], ...]
+			if len(coord) == 4 && coord[0] == 0 && coord[1] == 1 && coord[3] == 0 {
+				var entry DictionaryEntry
+				if tokText != "null" {
+					entry.PartOfSpeech, err = unquote(tokText)
+				}
+				result.translated.dictionary = append(result.translated.dictionary, entry)
+			}
+			if len(coord) == 5 && coord[0] == 0 && coord[1] == 1 && coord[3] == 1 && len(result.translated.dictionary) > 0 {
+				entry := &result.translated.dictionary[len(result.translated.dictionary)-1]
+				var term string
+				term, err = unquote(tokText)
+				entry.Terms = append(entry.Terms, term)
+			}
 			if len(coord) == 2 && coord[0] == 0 && coord[1] == 2 {
-				result.detected.originalLanguage = tokText[1 : len(tokText)-1]
+				result.detected.originalLanguage, err = unquote(tokText)
 			}
 			if len(coord) == 2 && coord[0] == 0 && coord[1] == 6 {
 				result.detected.confidence, _ = strconv.ParseFloat(s.TokenText(), 64)
 			}
+			if err != nil {
+				return emptyRawTranslated, err
+			}
 		}
 	}
+	if errs > 0 || len(coord) != 1 {
+		return emptyRawTranslated, ErrMalformed
+	}
 	result.translated.text = textBuilder.String()
 
 	return result, nil
 }
 
+// unquote decodes the json string literal tok,
+// it returns ErrMalformed if tok isn't one, for example a number
+func unquote(tok string) (string, error) {
+	var s string
+	if err := json.Unmarshal([]byte(tok), &s); err != nil {
+		return "", ErrMalformed
+	}
+	return s, nil
+}
+
 // Append appends serviceURLS to  t's serviceURLs
 func (t *Translator) Append(serviceURLs ...string) {
+	t.m.Lock()
 	t.serviceURLs = append(t.serviceURLs, serviceURLs...)
+	t.m.Unlock()
+}
+
+// randomServiceURL picks a service url whose host isn't blocked,
+// if they all are, it returns the ErrBlocked of the first one to cool down
+func (t *Translator) randomServiceURL() (string, error) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	var (
+		now       = time.Now()
+		available = make([]string, 0, len(t.serviceURLs))
+		blocked   *ErrBlocked
+	)
+	for _, serviceURL := range t.serviceURLs {
+		host := serviceHost(serviceURL)
+		until := t.health.blockedUntil(host)
+		if !now.Before(until) {
+			available = append(available, serviceURL)
+			continue
+		}
+		if blocked == nil || until.Sub(now) < blocked.CoolDown {
+			blocked = &ErrBlocked{Host: host, CoolDown: until.Sub(now)}
+		}
+	}
+	if len(available) == 0 {
+		return "", blocked
+	}
+	return random(available), nil
 }
 
-func (t *Translator) randomServiceURL() (serviceURL string) {
-	return random(t.serviceURLs)
+// serviceHost trims serviceURL down to scheme://host
+func serviceHost(serviceURL string) string {
+	u, err := url.Parse(serviceURL)
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(serviceURL, "/")
+	}
+	return u.Scheme + "://" + u.Host
 }
 
 func random(list []string) string {
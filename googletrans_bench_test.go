@@ -2,16 +2,38 @@ package googletrans
 
 import (
 	"testing"
+
+	"github.com/mind1949/googletrans/tkk"
 )
 
 func BenchmarkTranslate(b *testing.B) {
+	srv := newTestServer()
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+
 	for i := 0; i < b.N; i++ {
 		params := TranslateParams{
 			Src:  "auto",
 			Dest: "zh-CN",
 			Text: "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. ",
 		}
-		Translate(params)
+		translator.Translate(params)
+	}
+}
+
+func BenchmarkBuildTransRequest(b *testing.B) {
+	translator := NewWithOptions(WithTkk(tkk.Static("443916.547221231")))
+	defer translator.Close()
+	params := TranslateParams{
+		Src:  "auto",
+		Dest: "zh-CN",
+		Text: "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. ",
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		translator.buildTransRequest(translator.direct, "https://translate.google.cn", params)
 	}
 }
 
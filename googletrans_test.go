@@ -1,40 +1,402 @@
 package googletrans
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/googletranstest"
+	"github.com/mind1949/googletrans/pseudo"
+	"github.com/mind1949/googletrans/tk"
+	"github.com/mind1949/googletrans/tkk"
+	"github.com/mind1949/googletrans/transcookie"
 )
 
+const goText = "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. "
+
+// newTestServer starts a fake service translating goText to chinese
+func newTestServer(opts ...googletranstest.Option) *googletranstest.Server {
+	opts = append([]googletranstest.Option{googletranstest.WithTranslate(func(src, dest, text string) googletranstest.Translation {
+		if dest != "zh-CN" {
+			return googletranstest.Translation{Text: text, Src: "en", Confidence: 0.98}
+		}
+		return googletranstest.Translation{
+			Text:          "Go是一种开源编程语言，可轻松构建简单，可靠和高效的软件。",
+			Pronunciation: "Go shì yī zhǒng kāiyuán biānchéng yǔyán",
+			Src:           "en",
+			Confidence:    0.98,
+		}
+	})}, opts...)
+	return googletranstest.NewServer(opts...)
+}
+
+// newWrappedServer starts a server handing its requests to wrap, which passes them on to srv,
+// for tests watching or tampering with the requests to the service
+func newWrappedServer(srv *googletranstest.Server, wrap func(w http.ResponseWriter, r *http.Request, next http.Handler)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrap(w, r, srv.Config.Handler)
+	}))
+}
+
+// newTestTranslator initializes a Translator of srv
+func newTestTranslator(srv *googletranstest.Server, opts ...Option) *Translator {
+	opts = append([]Option{
+		WithServiceURLs(srv.URL),
+		WithHostPolicy(transcookie.AnyHost),
+	}, opts...)
+	return NewWithOptions(opts...)
+}
+
 func TestDo(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+
 	params := TranslateParams{
 		Src:  "auto",
 		Dest: "zh-CN",
-		Text: "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. ",
+		Text: goText,
 	}
-	transData, err := defaultTranslator.do(params)
+	transData, err := translator.do(context.Background(), params)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if transData.detected.originalLanguage != "en" || transData.detected.confidence != 0.98 {
+		t.Errorf("wrong detection: %+v", transData.detected)
 	}
-	t.Logf("%+v\n", transData)
 }
 
 func TestTranslate(t *testing.T) {
-	params := TranslateParams{
-		Src:  "auto",
+	srv := newTestServer()
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+
+	for _, text := range []string{goText, strings.Repeat(goText, 20)} {
+		params := TranslateParams{
+			Src:  "auto",
+			Dest: "zh-CN",
+			Text: text,
+		}
+		translated, err := translator.Translate(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := Translated{
+			Params:        params,
+			Text:          "Go是一种开源编程语言，可轻松构建简单，可靠和高效的软件。",
+			Pronunciation: "Go shì yī zhǒng kāiyuán biānchéng yǔyán",
+		}
+		if translated != expect {
+			t.Errorf("expect: %+v, got: %+v", expect, translated)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+
+	detected, err := translator.Detect(goText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (Detected{Lang: "en", Confidence: 0.98}); detected != expect {
+		t.Errorf("expect: %+v, got: %+v", expect, detected)
+	}
+}
+
+var record = flag.Bool("record", false, "record the fixtures of replayed tests from the live service")
+
+func TestParseEscaped(t *testing.T) {
+	cases := []struct {
+		raw           string
+		text          string
+		pronunciation string
+	}{
+		{`[[["say \"hi\"","hi",null,null,1]],null,"en"]`, `say "hi"`, ""},
+		{`[[["\u003cb\u003eHallo\u003c/b\u003e \u0026 caf\u00e9","hello",null,null,1]],null,"en"]`, "<b>Hallo</b> & café", ""},
+		{`[[["\ud83d\ude00 C:\\go\nbin","x",null,null,1],[null,null,"n\u01d0 h\u01ceo"]],null,"zh-CN"]`, "\U0001f600 C:\\go\nbin", "nǐ hǎo"},
+		{`[[["a\/b","a/b",null,null,1]],null,"en"]`, "a/b", ""},
+	}
+	for _, c := range cases {
+		result, err := new(Translator).parseRawTranslated([]byte(c.raw))
+		if err != nil {
+			t.Errorf("parse %s: %v", c.raw, err)
+			continue
+		}
+		if result.translated.text != c.text || result.translated.pronunciation != c.pronunciation {
+			t.Errorf("parse %s: expect %q %q, got %q %q", c.raw, c.text, c.pronunciation, result.translated.text, result.translated.pronunciation)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, raw := range []string{
+		`[[["a","b"]],[["noun",[1]]]]`,
+		`[[[1,"b"]]]`,
+		`[[["a"]],null,1]`,
+		`[[["a","b",null,null,1],[null,null,2]],null,"en"]`,
+		`[[["a","b"]],[[true]]]`,
+	} {
+		if _, err := new(Translator).parseRawTranslated([]byte(raw)); err != ErrMalformed {
+			t.Errorf("parse %s: expect ErrMalformed, got: %v", raw, err)
+		}
+	}
+}
+
+// TestReplay replays testdata/translate.google.cn.json,
+// which is hand-built until it's recorded with -record, see its note
+func TestReplay(t *testing.T) {
+	mode := googletranstest.Replay
+	if *record {
+		mode = googletranstest.Record
+	}
+	recorder, err := googletranstest.NewRecorder("testdata/translate.google.cn.json", mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := recorder.Save(); err != nil {
+			t.Error(err)
+		}
+	}()
+	text, err := ioutil.ReadFile("testdata/strings.en.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	translator := NewWithOptions(
+		WithServiceURLs("https://translate.google.cn"),
+		WithClient(&http.Client{Transport: recorder}),
+	)
+	defer translator.Close()
+	translated, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: string(text)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *record {
+		// the live translation may differ from the recorded one
+		return
+	}
+	if !strings.HasPrefix(translated.Text, "Go中的字符串，字节，符文和字符") {
+		t.Errorf("wrong translation: %.100s", translated.Text)
+	}
+	if !strings.HasSuffix(translated.Text, "包米") {
+		end := translated.Text
+		if len(end) > 60 {
+			end = end[len(end)-60:]
+		}
+		t.Errorf("wrong end of translation: %q", end)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	params := TranslateParams{Dest: "zh-CN", Text: goText}
+	for _, tt := range []struct {
+		name   string
+		faults []googletranstest.Fault
+		check  func(err error) bool
+	}{
+		{"retry forbidden", []googletranstest.Fault{googletranstest.Forbidden}, func(err error) bool {
+			return err == nil
+		}},
+		{"retry too many requests", []googletranstest.Fault{googletranstest.TooManyRequests}, func(err error) bool {
+			return err == nil
+		}},
+		{"malformed json", []googletranstest.Fault{googletranstest.MalformedJSON}, func(err error) bool {
+			return errors.Is(err, ErrMalformed)
+		}},
+		{"blocked", []googletranstest.Fault{googletranstest.Blocked}, func(err error) bool {
+			var blocked *ErrBlocked
+			return errors.As(err, &blocked)
+		}},
+		{"interstitial", []googletranstest.Fault{googletranstest.Interstitial}, func(err error) bool {
+			var blocked *ErrBlocked
+			return errors.As(err, &blocked)
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer()
+			defer srv.Close()
+			srv.Inject(tt.faults...)
+			translator := newTestTranslator(srv)
+			defer translator.Close()
+
+			if _, err := translator.Translate(params); !tt.check(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	srv := newTestServer(googletranstest.WithLatency(time.Second))
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := translator.TranslateContext(ctx, params); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect the deadline to be exceeded, got: %v", err)
+	}
+}
+
+func TestWithTkk(t *testing.T) {
+	translator := NewWithOptions(
+		WithServiceURLs("https://translate.example.com"),
+		WithTkk(tkk.Static("443916.547221231")),
+	)
+	defer translator.Close()
+
+	req, err := translator.buildTransRequest(translator.direct, "https://translate.example.com", TranslateParams{
 		Dest: "zh-CN",
-		Text: "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. ",
+		Text: "hello\u00A0world",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "68957.510801"; req.URL.Query().Get("tk") != expect {
+		t.Errorf("wrong tk, expect: %q, got: %q", expect, req.URL.Query().Get("tk"))
+	}
+}
+
+func TestWithSigner(t *testing.T) {
+	translator := NewWithOptions(
+		WithServiceURLs("https://translate.example.com"),
+		WithSigner(NoopSigner),
+	)
+	defer translator.Close()
+
+	params := TranslateParams{Dest: "zh-CN", Text: "hello"}
+	req, err := translator.buildTransRequest(translator.direct, "https://translate.example.com", params)
+	if err != nil {
+		t.Fatal(err)
 	}
-	translated, err := defaultTranslator.Translate(params)
+	if _, ok := req.URL.Query()["tk"]; ok {
+		t.Errorf("NoopSigner added tk: %q", req.URL.Query().Get("tk"))
+	}
+	if len(translator.direct.tkkCaches) != 0 {
+		t.Errorf("NoopSigner created %d tkk caches", len(translator.direct.tkkCaches))
+	}
+
+	translator = NewWithOptions(
+		WithServiceURLs("https://translate.example.com"),
+		WithSigner(SignerFunc(func(serviceURL, text string, query url.Values) error {
+			query.Set("key", serviceURL+"/"+text)
+			return nil
+		})),
+	)
+	req, err = translator.buildTransRequest(translator.direct, "https://translate.example.com", params)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if expect := "https://translate.example.com/hello"; req.URL.Query().Get("key") != expect {
+		t.Errorf("wrong key, expect: %q, got: %q", expect, req.URL.Query().Get("key"))
 	}
-	t.Logf("%+v\n", translated)
 }
 
-func TestDetect(t *testing.T) {
-	text := "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. "
-	detected, err := defaultTranslator.Detect(text)
+func TestTkkSigner(t *testing.T) {
+	current := tkk.Static("443916.547221231")
+	signer := TkkSigner(func(string) tkk.Cache { return current })
+	for _, v := range []string{"443916.547221231", "443917.1"} {
+		current = tkk.Static(v)
+		query := url.Values{}
+		if err := signer.Sign("https://translate.example.com", "hello", query); err != nil {
+			t.Fatal(err)
+		}
+		if expect, _ := tk.Get("hello", v); query.Get("tk") != expect {
+			t.Errorf("wrong tk for tkk %q, expect: %q, got: %q", v, expect, query.Get("tk"))
+		}
+	}
+
+	current = tkk.Static("invalid")
+	if err := signer.Sign("https://translate.example.com", "hello", url.Values{}); err != tk.ErrInvalidTkk {
+		t.Errorf("expect tk.ErrInvalidTkk, got: %v", err)
+	}
+}
+
+func TestCustomServiceURL(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	translator := NewWithOptions(WithServiceURLs(srv.URL))
+	_, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+	if err != transcookie.ErrInvalidServiceURL {
+		t.Errorf("expect the default host policy to reject %s, got: %v", srv.URL, err)
+	}
+
+	translator = NewWithOptions(
+		WithServiceURLs(srv.URL),
+		WithHostPolicy(transcookie.AnyHost),
+	)
+	translated, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translated.Pronunciation != "Go shì yī zhǒng kāiyuán biānchéng yǔyán" {
+		t.Errorf("wrong translation: %+v", translated)
+	}
+}
+
+func TestWithPseudo(t *testing.T) {
+	translator := NewWithOptions(
+		WithServiceURLs("https://translate.example.com"),
+		WithPseudo(pseudo.New()),
+	)
+	defer translator.Close()
+
+	params := TranslateParams{Dest: "fr", Text: "Hello {name}"}
+	translated, err := translator.Translate(params)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if expect := "[Ħḗŀŀǿ {name}~~]"; translated.Text != expect {
+		t.Errorf("expect: %q, got: %q", expect, translated.Text)
+	}
+	detected, err := translator.Detect("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (Detected{Lang: "en", Confidence: 1}); detected != expect {
+		t.Errorf("expect: %+v, got: %+v", expect, detected)
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	srv := googletranstest.NewServer(googletranstest.WithTranslate(func(src, dest, text string) googletranstest.Translation {
+		return googletranstest.Translation{
+			Text:       "Hallo",
+			Src:        "en",
+			Confidence: 1,
+			Dictionary: []googletranstest.DictionaryEntry{
+				{PartOfSpeech: "interjection", Terms: []string{"Hallo!", "Hi!"}},
+				{PartOfSpeech: "noun", Terms: []string{"Hallo"}},
+			},
+		}
+	}))
+	defer srv.Close()
+	translator := newTestTranslator(srv)
+	defer translator.Close()
+
+	translated, dictionary, err := translator.TranslateDictionary(TranslateParams{Dest: "de", Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []DictionaryEntry{
+		{PartOfSpeech: "interjection", Terms: []string{"Hallo!", "Hi!"}},
+		{PartOfSpeech: "noun", Terms: []string{"Hallo"}},
+	}
+	if translated.Text != "Hallo" || !reflect.DeepEqual(dictionary, expect) {
+		t.Errorf("expect Hallo with dictionary %+v, got: %+v %+v", expect, translated, dictionary)
 	}
-	t.Logf("%+v\n", detected)
 }
@@ -0,0 +1,263 @@
+// Package googletranstest provides a fake google translation service,
+// so that translations can be tested deterministically and offline
+package googletranstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/mind1949/googletrans/tk"
+)
+
+// Translation is what the service answers a translation request with
+type Translation struct {
+	Text          string  // translated text
+	Pronunciation string  // pronunciation of the translated text
+	Src           string  // detected source language
+	Confidence    float64 // confidence of the detection (0.00 to 1.00)
+
+	Dictionary []DictionaryEntry // translations of a single word by part of speech
+}
+
+// DictionaryEntry is the translations of a word as a part of speech
+type DictionaryEntry struct {
+	PartOfSpeech string
+	Terms        []string
+}
+
+// TranslateFunc translates text from src, which may be "auto", to dest
+type TranslateFunc func(src, dest, text string) Translation
+
+// Echo is the default TranslateFunc, it leaves text unchanged
+// and detects it as english unless src is given
+func Echo(src, dest, text string) Translation {
+	if src == "" || src == "auto" {
+		src = "en"
+	}
+	return Translation{Text: text, Src: src, Confidence: 1}
+}
+
+// Fault is a failure injected into a translation request
+type Fault int
+
+const (
+	// TooManyRequests answers 429 Too Many Requests
+	TooManyRequests Fault = iota + 1
+	// Forbidden answers 403 Forbidden, as for a tk signed with a stale tkk
+	Forbidden
+	// Blocked redirects to the captcha page
+	Blocked
+	// Interstitial answers an html "unusual traffic" page
+	Interstitial
+	// MalformedJSON answers truncated translation data,
+	// the Translator returns googletrans.ErrMalformed
+	MalformedJSON
+)
+
+// Server is a fake google translation service,
+// its URL is a service url, which the default host policy rejects,
+// so translators need googletrans.WithHostPolicy(transcookie.AnyHost)
+type Server struct {
+	*httptest.Server
+
+	translate TranslateFunc
+	latency   time.Duration
+	suffix    int64 // tkk is hours since the unix epoch '.' suffix
+
+	m        sync.Mutex
+	faults   []Fault
+	requests int
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithTranslate sets how the server translates, Echo by default
+func WithTranslate(translate TranslateFunc) Option {
+	return func(s *Server) {
+		s.translate = translate
+	}
+}
+
+// WithLatency delays every translation request by d
+func WithLatency(d time.Duration) Option {
+	return func(s *Server) {
+		s.latency = d
+	}
+}
+
+// NewServer starts a Server, the caller should call Close when finished
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		translate: Echo,
+		suffix:    3002,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveHome)
+	mux.HandleFunc("/translate_a/single", s.serveTranslate)
+	mux.HandleFunc("/sorry/index", s.serveSorry)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Tkk returns the tkk the server currently serves
+func (s *Server) Tkk() string {
+	return s.tkk(time.Now())
+}
+
+func (s *Server) tkk(now time.Time) string {
+	return fmt.Sprintf("%d.%d", now.Unix()/3600, s.suffix)
+}
+
+// Inject makes the next translation requests fail with faults, one each
+func (s *Server) Inject(faults ...Fault) {
+	s.m.Lock()
+	s.faults = append(s.faults, faults...)
+	s.m.Unlock()
+}
+
+// Requests returns the number of translation requests the server received
+func (s *Server) Requests() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.requests
+}
+
+// serveHome sets the NID cookie and serves a page carrying tkk
+func (s *Server) serveHome(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "NID",
+		Value:    "204=googletranstest",
+		Path:     "/",
+		Expires:  time.Now().Add(180 * 24 * time.Hour),
+		HttpOnly: true,
+	})
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, "<html><script>window.WIZ_global_data={tkk:'%s'};</script></html>", s.Tkk())
+}
+
+// serveTranslate serves GET and POST /translate_a/single
+func (s *Server) serveTranslate(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	s.requests++
+	var fault Fault
+	if len(s.faults) > 0 {
+		fault = s.faults[0]
+		s.faults = s.faults[1:]
+	}
+	s.m.Unlock()
+
+	if s.latency > 0 {
+		timer := time.NewTimer(s.latency)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	switch fault {
+	case TooManyRequests:
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	case Forbidden:
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case Blocked:
+		http.Redirect(w, r, "/sorry/index?continue="+r.URL.String(), http.StatusFound)
+		return
+	case Interstitial:
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		fmt.Fprint(w, "<html><body>Our systems have detected unusual traffic from your computer network.</body></html>")
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	text := r.FormValue("q")
+	if _, err := r.Cookie("NID"); err != nil || !s.validTk(r.FormValue("tk"), text) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	translation := s.translate(q.Get("sl"), q.Get("tl"), text)
+	var pronunciation interface{}
+	if translation.Pronunciation != "" {
+		pronunciation = translation.Pronunciation
+	}
+	var dictionary interface{}
+	if len(translation.Dictionary) > 0 {
+		entries := make([]interface{}, 0, len(translation.Dictionary))
+		for _, entry := range translation.Dictionary {
+			reverse := make([]interface{}, 0, len(entry.Terms))
+			for _, term := range entry.Terms {
+				reverse = append(reverse, []interface{}{term, []string{text}, nil, 0.5})
+			}
+			entries = append(entries, []interface{}{entry.PartOfSpeech, entry.Terms, reverse, text, 1})
+		}
+		dictionary = entries
+	}
+	data, err := marshal([]interface{}{
+		[]interface{}{
+			[]interface{}{translation.Text, text, nil, nil, 1},
+			[]interface{}{nil, nil, pronunciation},
+		},
+		dictionary, translation.Src, nil, nil, nil, translation.Confidence,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if fault == MalformedJSON {
+		data = data[:len(data)/2]
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(data)
+}
+
+// validTk reports whether tk signs text with the tkk of the current hour,
+// or of the previous one for requests signed just before it ended
+func (s *Server) validTk(v, text string) bool {
+	now := time.Now()
+	for _, t := range []time.Time{now, now.Add(-time.Hour)} {
+		if expect, err := tk.Get(text, s.tkk(t)); err == nil && v == expect {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSorry serves the captcha page
+func (s *Server) serveSorry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprint(w, `<html><body>Our systems have detected unusual traffic from your computer network.<div class="g-recaptcha"></div></body></html>`)
+}
+
+// marshal encodes v as json without escaping html characters like google does
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package googletranstest
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mind1949/googletrans/tk"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "NID" {
+		t.Fatalf("expect the NID cookie, got: %+v", cookies)
+	}
+
+	sign, _ := tk.Get("hello", srv.Tkk())
+	srv.Inject(TooManyRequests)
+	for _, tt := range []struct {
+		tk     string
+		cookie bool
+		expect int
+	}{
+		{sign, true, http.StatusTooManyRequests},
+		{sign, true, http.StatusOK},
+		{"1.1", true, http.StatusForbidden},
+		{sign, false, http.StatusForbidden},
+	} {
+		q := url.Values{"sl": {"auto"}, "tl": {"zh-CN"}, "q": {"hello"}, "tk": {tt.tk}}
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/translate_a/single?"+q.Encode(), nil)
+		if tt.cookie {
+			req.AddCookie(cookies[0])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.expect {
+			t.Errorf("tk %s, cookie %t: expect status %d, got %d", tt.tk, tt.cookie, tt.expect, resp.StatusCode)
+		}
+	}
+	if n := srv.Requests(); n != 4 {
+		t.Errorf("expect 4 translation requests, got %d", n)
+	}
+}
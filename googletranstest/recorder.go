@@ -0,0 +1,201 @@
+package googletranstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Mode is whether a Recorder records or replays
+type Mode int
+
+const (
+	// Replay answers requests with the responses of a fixture file
+	Replay Mode = iota
+	// Record sends requests and records them to a fixture file
+	Record
+)
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+	Note     string           `json:"note,omitempty"` // for hand-built fixtures, never recorded
+}
+
+// RecordedRequest is what requests are matched on,
+// the volatile tk and the other query parameters are left out
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Src    string `json:"src,omitempty"`  // sl of translation requests
+	Dest   string `json:"dest,omitempty"` // tl of translation requests
+	Text   string `json:"text,omitempty"` // q of translation requests, from the query or the form
+}
+
+// RecordedResponse is a recorded response
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Recorder is an http.RoundTripper recording the tkk page, cookie fetches
+// and translations to a fixture file, and replaying them later,
+// requests with the same RecordedRequest are answered in the recorded order,
+// the last response being repeated
+type Recorder struct {
+	// Transport sends the requests being recorded, http.DefaultTransport if nil
+	Transport http.RoundTripper
+
+	name string
+	mode Mode
+
+	m            sync.Mutex
+	interactions []Interaction
+	replayed     map[RecordedRequest]int
+}
+
+// NewRecorder initializes a Recorder of the fixture file name,
+// which is loaded in Replay mode
+func NewRecorder(name string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		name:     name,
+		mode:     mode,
+		replayed: make(map[RecordedRequest]int),
+	}
+	if mode != Replay {
+		return r, nil
+	}
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("googletranstest: invalid fixture %s: %v", name, err)
+	}
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, req, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == Replay {
+		return r.replay(recorded, req)
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	r.m.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       string(body),
+		},
+	})
+	r.m.Unlock()
+	return resp, nil
+}
+
+// replay answers req with the next response recorded for it
+func (r *Recorder) replay(recorded RecordedRequest, req *http.Request) (*http.Response, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var matches []RecordedResponse
+	for _, interaction := range r.interactions {
+		if interaction.Request == recorded {
+			matches = append(matches, interaction.Response)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("googletranstest: no recorded response for %s %s%s", recorded.Method, recorded.Host, recorded.Path)
+	}
+	i := r.replayed[recorded]
+	if i >= len(matches) {
+		i = len(matches) - 1
+	}
+	r.replayed[recorded]++
+
+	recordedResp := matches[i]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recordedResp.StatusCode, http.StatusText(recordedResp.StatusCode)),
+		StatusCode:    recordedResp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recordedResp.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(recordedResp.Body))),
+		ContentLength: int64(len(recordedResp.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Save writes the recorded interactions to the fixture file in Record mode
+func (r *Recorder) Save() error {
+	if r.mode != Record {
+		return nil
+	}
+	r.m.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.m.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.name, data, 0644)
+}
+
+// recordRequest returns what req is matched on,
+// and a copy of req whose body can still be read
+func recordRequest(req *http.Request) (RecordedRequest, *http.Request, error) {
+	recorded := RecordedRequest{
+		Method: req.Method,
+		Host:   req.URL.Host,
+		Path:   req.URL.Path,
+	}
+	if recorded.Path == "" {
+		recorded.Path = "/"
+	}
+	query := req.URL.Query()
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return recorded, nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k, v := range form {
+				query[k] = append(query[k], v...)
+			}
+		}
+	}
+	recorded.Src = query.Get("sl")
+	recorded.Dest = query.Get("tl")
+	recorded.Text = query.Get("q")
+	return recorded, req, nil
+}
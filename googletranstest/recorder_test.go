@@ -0,0 +1,93 @@
+package googletranstest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mind1949/googletrans/tk"
+)
+
+func TestRecorder(t *testing.T) {
+	srv := NewServer(WithTranslate(func(src, dest, text string) Translation {
+		return Translation{Text: strings.ToUpper(text), Src: "en", Confidence: 1}
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "googletranstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "fixture.json")
+
+	translate := func(clt *http.Client, method, text, tk string) (int, string) {
+		q := url.Values{"sl": {"auto"}, "tl": {"zh-CN"}, "tk": {tk}}
+		var req *http.Request
+		if method == http.MethodGet {
+			q.Set("q", text)
+			req, _ = http.NewRequest(method, srv.URL+"/translate_a/single?"+q.Encode(), nil)
+		} else {
+			req, _ = http.NewRequest(method, srv.URL+"/translate_a/single?"+q.Encode(), strings.NewReader(url.Values{"q": {text}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.AddCookie(&http.Cookie{Name: "NID", Value: "1"})
+		resp, err := clt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	recorder, err := NewRecorder(name, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clt := &http.Client{Transport: recorder}
+	srv.Inject(TooManyRequests)
+	sign := func(text string) string {
+		v, _ := tk.Get(text, srv.Tkk())
+		return v
+	}
+	recorded := map[string][2]interface{}{}
+	for _, c := range []struct{ method, text string }{
+		{http.MethodGet, "hello"},
+		{http.MethodGet, "hello"},
+		{http.MethodPost, "world"},
+	} {
+		status, body := translate(clt, c.method, c.text, sign(c.text))
+		recorded[c.method+c.text] = [2]interface{}{status, body}
+	}
+	if err = recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	recorder, err = NewRecorder(name, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clt = &http.Client{Transport: recorder}
+	// the first request got 429, the same request is answered in the recorded order
+	if status, _ := translate(clt, http.MethodGet, "hello", "1.1"); status != http.StatusTooManyRequests {
+		t.Errorf("expect the recorded 429, got %d", status)
+	}
+	for i := 0; i < 2; i++ {
+		status, body := translate(clt, http.MethodGet, "hello", "1.1")
+		if expect := recorded[http.MethodGet+"hello"]; status != expect[0] || body != expect[1] {
+			t.Errorf("expect %v, got %d %s", expect, status, body)
+		}
+	}
+	status, body := translate(clt, http.MethodPost, "world", "2.2")
+	if expect := recorded[http.MethodPost+"world"]; status != expect[0] || body != expect[1] || !strings.Contains(body, "WORLD") {
+		t.Errorf("expect %v, got %d %s", expect, status, body)
+	}
+	if _, err = clt.Get(srv.URL + "/translate_a/single?q=unknown"); err == nil {
+		t.Error("expect no recorded response for an unknown request")
+	}
+}
@@ -0,0 +1,91 @@
+package googletrans
+
+import (
+	"sync"
+	"time"
+)
+
+// HostStats is the health of a service host as seen by a Translator
+type HostStats struct {
+	Successes    int64     `json:"successes"`
+	Failures     int64     `json:"failures"`
+	LastSuccess  time.Time `json:"last_success"`
+	LastFailure  time.Time `json:"last_failure"`
+	LastStatus   int       `json:"last_status,omitempty"`   // http status of the last failure, 0 if the request failed
+	BlockedUntil time.Time `json:"blocked_until,omitempty"` // no requests are sent before it
+}
+
+// health keeps the HostStats of every service host
+type health struct {
+	m     sync.Mutex
+	hosts map[string]*HostStats
+}
+
+func (h *health) host(serviceURL string) *HostStats {
+	if h.hosts == nil {
+		h.hosts = make(map[string]*HostStats)
+	}
+	stats, ok := h.hosts[serviceURL]
+	if !ok {
+		stats = &HostStats{}
+		h.hosts[serviceURL] = stats
+	}
+	return stats
+}
+
+func (h *health) success(serviceURL string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	stats := h.host(serviceURL)
+	stats.Successes++
+	stats.LastSuccess = time.Now()
+}
+
+func (h *health) failure(serviceURL string, status int) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	stats := h.host(serviceURL)
+	stats.Failures++
+	stats.LastFailure = time.Now()
+	stats.LastStatus = status
+}
+
+func (h *health) block(serviceURL string, until time.Time) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.host(serviceURL).BlockedUntil = until
+}
+
+func (h *health) blockedUntil(serviceURL string) time.Time {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if stats, ok := h.hosts[serviceURL]; ok {
+		return stats.BlockedUntil
+	}
+	return time.Time{}
+}
+
+func (h *health) stats() map[string]HostStats {
+	h.m.Lock()
+	defer h.m.Unlock()
+	stats := make(map[string]HostStats, len(h.hosts))
+	for serviceURL, s := range h.hosts {
+		stats[serviceURL] = *s
+	}
+	return stats
+}
+
+// restore replaces the stats of the hosts in stats
+func (h *health) restore(stats map[string]HostStats) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	for serviceURL, s := range stats {
+		*h.host(serviceURL) = s
+	}
+}
+
+// Stats returns the health of every service host t has sent requests to,
+// keyed by scheme://host
+func (t *Translator) Stats() map[string]HostStats {
+	return t.health.stats()
+}
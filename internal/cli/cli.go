@@ -0,0 +1,99 @@
+// Package cli holds the flags the googletrans commands share
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mind1949/googletrans"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+// Strings is a flag that can be repeated
+type Strings []string
+
+func (f *Strings) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *Strings) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// TranslatorFlags are the flags configuring the Translator of a command
+type TranslatorFlags struct {
+	ServiceURLs Strings
+	AnyHost     bool
+	Proxies     Strings
+	Ejection    time.Duration
+	State       string // file the session state is kept in, none if empty
+}
+
+// Register defines the flags in fs, the state file defaults to f.State
+func (f *TranslatorFlags) Register(fs *flag.FlagSet) {
+	fs.Var(&f.ServiceURLs, "service-url", "service `url`, can be repeated (default https://translate.google.cn)")
+	fs.BoolVar(&f.AnyHost, "any-host", false, "allow service urls that aren't google translation hosts")
+	fs.Var(&f.Proxies, "proxy", "http, https or socks5 proxy `url` with optional credentials, can be repeated")
+	fs.DurationVar(&f.Ejection, "proxy-ejection", 10*time.Minute, "how long a blocked or failing proxy is left out")
+	fs.StringVar(&f.State, "state", f.State, "`file` keeping tkk and cookies between runs")
+}
+
+// Policy is the host policy the flags configure
+func (f *TranslatorFlags) Policy() transcookie.HostPolicy {
+	if f.AnyHost {
+		return transcookie.AnyHost
+	}
+	return transcookie.GoogleHosts
+}
+
+// Translator initializes the Translator the flags configure, then extra,
+// loading the state file if there is one
+func (f *TranslatorFlags) Translator(extra ...googletrans.Option) (*googletrans.Translator, error) {
+	var opts []googletrans.Option
+	if len(f.ServiceURLs) > 0 {
+		opts = append(opts, googletrans.WithServiceURLs(f.ServiceURLs...))
+	}
+	if f.AnyHost {
+		opts = append(opts, googletrans.WithHostPolicy(transcookie.AnyHost))
+	}
+	if len(f.Proxies) > 0 {
+		proxies := make([]*url.URL, 0, len(f.Proxies))
+		for _, proxy := range f.Proxies {
+			u, err := url.Parse(proxy)
+			if err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid proxy %q", proxy)
+			}
+			proxies = append(proxies, u)
+		}
+		opts = append(opts,
+			googletrans.WithProxies(proxies...),
+			googletrans.WithProxyEjection(f.Ejection),
+		)
+	}
+	translator := googletrans.NewWithOptions(append(opts, extra...)...)
+	if f.State != "" {
+		if err := translator.LoadStateFile(f.State); err != nil {
+			translator.Close()
+			return nil, err
+		}
+	}
+	return translator, nil
+}
+
+// Close saves the session state of translator, then closes it
+func (f *TranslatorFlags) Close(translator *googletrans.Translator) error {
+	defer translator.Close()
+	if f.State == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.State), 0755); err != nil {
+		return err
+	}
+	return translator.SaveStateFile(f.State)
+}
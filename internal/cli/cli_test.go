@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mind1949/googletrans"
+	"github.com/mind1949/googletrans/googletranstest"
+)
+
+func TestTranslatorFlags(t *testing.T) {
+	srv := googletranstest.NewServer()
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state := filepath.Join(dir, "cache", "state.json")
+
+	var f TranslatorFlags
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f.Register(fs)
+	if err := fs.Parse([]string{"--service-url", srv.URL, "--service-url", srv.URL + "/", "--any-host", "--state", state}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.ServiceURLs) != 2 || f.ServiceURLs.String() != srv.URL+","+srv.URL+"/" {
+		t.Errorf("expect 2 service urls, got: %s", f.ServiceURLs.String())
+	}
+	if !f.Policy()("example.com") {
+		t.Error("expect --any-host to allow any host")
+	}
+
+	translator, err := f.Translator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := translator.Translate(googletrans.TranslateParams{Dest: "de", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(translator); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(state); err != nil {
+		t.Errorf("expect the state to be saved: %v", err)
+	}
+
+	f = TranslatorFlags{Proxies: Strings{"not a proxy"}}
+	if _, err := f.Translator(); err == nil {
+		t.Error("expect an invalid proxy to fail")
+	}
+	if f.Policy()("example.com") {
+		t.Error("expect only google hosts by default")
+	}
+}
@@ -0,0 +1,109 @@
+package googletrans
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Rotation is how a Translator rotates across its local addresses
+type Rotation int
+
+const (
+	// PerRequest sends each request from the next local address
+	PerRequest Rotation = iota
+	// PerHost sends all the requests to a host from the same local address,
+	// so that its cookies and tkk stay tied to one address
+	PerHost
+)
+
+// WithLocalAddrs binds the connections of a Translator to addrs,
+// which are local IPv4 or IPv6 addresses, rotating across them
+// per request unless WithLocalAddrRotation says otherwise
+func WithLocalAddrs(addrs ...net.IP) Option {
+	return func(t *Translator) {
+		t.localAddrs = addrs
+	}
+}
+
+// WithLocalAddrRotation sets how a Translator rotates across its local addresses
+func WithLocalAddrRotation(rotation Rotation) Option {
+	return func(t *Translator) {
+		t.rotation = rotation
+	}
+}
+
+// transport returns the transport of requests sent through proxy,
+// which is nil for direct requests, bound to t's local addresses
+func (t *Translator) transport(proxy *url.URL) http.RoundTripper {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	dialTimeout := 30 * time.Second
+	if proxy != nil {
+		base.Proxy = http.ProxyURL(proxy)
+		dialTimeout = proxyDialTimeout
+		base.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if len(t.localAddrs) == 0 {
+		return base
+	}
+
+	rt := &localAddrTransport{rotation: t.rotation}
+	for _, ip := range t.localAddrs {
+		transport := base.Clone()
+		transport.DialContext = bindDialer(ip, dialTimeout)
+		rt.transports = append(rt.transports, transport)
+	}
+	return rt
+}
+
+// localAddrTransport rotates requests across transports,
+// one for each local address, since a transport reuses its connections
+type localAddrTransport struct {
+	rotation   Rotation
+	transports []*http.Transport
+	next       uint32
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *localAddrTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var i uint32
+	switch rt.rotation {
+	case PerHost:
+		h := fnv.New32a()
+		h.Write([]byte(req.URL.Host))
+		i = h.Sum32()
+	default:
+		i = atomic.AddUint32(&rt.next, 1) - 1
+	}
+	return rt.transports[i%uint32(len(rt.transports))].RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of every local address
+func (rt *localAddrTransport) CloseIdleConnections() {
+	for _, transport := range rt.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// bindDialer dials from ip, only to remote addresses of ip's family
+func bindDialer(ip net.IP, timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		LocalAddr: &net.TCPAddr{IP: ip},
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network == "tcp" {
+			if ip.To4() != nil {
+				network = "tcp4"
+			} else {
+				network = "tcp6"
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,110 @@
+package googletrans
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+func TestLocalAddrs(t *testing.T) {
+	var (
+		m       sync.Mutex
+		remotes = make(map[string]int)
+	)
+	fake := newTestServer()
+	defer fake.Close()
+	srv := newWrappedServer(fake, func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		m.Lock()
+		remotes[host]++
+		m.Unlock()
+		if r.URL.Path == "/translate_a/single" {
+			// close the connection so that no request reuses it
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+	defer srv.Close()
+
+	addrs := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3")}
+	for _, ip := range addrs {
+		conn, err := bindDialer(ip, time.Second)(context.Background(), "tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Skipf("can't bind %s: %v", ip, err)
+		}
+		conn.Close()
+	}
+
+	for _, tt := range []struct {
+		rotation Rotation
+		expect   int
+	}{
+		{PerRequest, len(addrs)},
+		{PerHost, 1},
+	} {
+		m.Lock()
+		remotes = make(map[string]int)
+		m.Unlock()
+
+		translator := NewWithOptions(
+			WithServiceURLs(srv.URL),
+			WithHostPolicy(transcookie.AnyHost),
+			WithLocalAddrs(addrs...),
+			WithLocalAddrRotation(tt.rotation),
+		)
+		for i := 0; i < 6; i++ {
+			if _, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		translator.Close()
+
+		m.Lock()
+		if len(remotes) != tt.expect {
+			t.Errorf("rotation %d: expect requests from %d addresses, got: %v", tt.rotation, tt.expect, remotes)
+		}
+		m.Unlock()
+	}
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	fake := newTestServer()
+	defer fake.Close()
+	var open int32
+	srv := httptest.NewUnstartedServer(fake.Config.Handler)
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			atomic.AddInt32(&open, 1)
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt32(&open, -1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	translator := NewWithOptions(
+		WithServiceURLs(srv.URL),
+		WithHostPolicy(transcookie.AnyHost),
+		WithLocalAddrs(net.ParseIP("127.0.0.1")),
+	)
+	if _, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&open) == 0 {
+		t.Fatal("expect idle connections to the service")
+	}
+	translator.Close()
+	for start := time.Now(); atomic.LoadInt32(&open) > 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expect Close to close the idle connections, %d still open", atomic.LoadInt32(&open))
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package googletrans
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/googletranstest"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+// newForwardProxy starts an http proxy counting the requests it forwards,
+// the requests of a blocked proxy are redirected to google's captcha page
+func newForwardProxy(t *testing.T, blocked bool) (*httptest.Server, *int64) {
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&n, 1)
+		if user, password, ok := proxyAuth(r); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		if blocked && r.URL.Path != "/sorry/index" {
+			http.Redirect(w, r, "/sorry/index", http.StatusFound)
+			return
+		}
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func proxyAuth(r *http.Request) (user, password string, ok bool) {
+	req := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+	return req.BasicAuth()
+}
+
+func TestProxies(t *testing.T) {
+	srv := googletranstest.NewServer()
+	defer srv.Close()
+
+	good, goodRequests := newForwardProxy(t, false)
+	bad, badRequests := newForwardProxy(t, true)
+	goodURL, _ := url.Parse(good.URL)
+	goodURL.User = url.UserPassword("user", "secret")
+	badURL, _ := url.Parse(bad.URL)
+	badURL.User = url.UserPassword("user", "secret")
+
+	// the first available proxy is picked, the bad one until it's ejected
+	defer func(intn func(int) int) { randIntn = intn }(randIntn)
+	randIntn = func(int) int { return 0 }
+	translator := NewWithOptions(
+		WithServiceURLs(srv.URL),
+		WithHostPolicy(transcookie.AnyHost),
+		WithProxies(badURL, goodURL),
+	)
+	defer translator.Close()
+	for i := 0; i < 10; i++ {
+		translated, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if translated.Text != "hello" {
+			t.Errorf("wrong translation: %+v", translated)
+		}
+	}
+
+	// cookies, tkk and translations all went through the good proxy
+	if n := atomic.LoadInt64(goodRequests); n < 12 {
+		t.Errorf("expect at least 12 requests through the good proxy, got %d", n)
+	}
+	stats := translator.ProxyStats()
+	goodKey := "http://user@" + goodURL.Host
+	badKey := "http://user@" + badURL.Host
+	if stats[goodKey].Successes != 10 || !stats[goodKey].BlockedUntil.IsZero() {
+		t.Errorf("wrong stats of the good proxy: %+v", stats[goodKey])
+	}
+	if n := atomic.LoadInt64(badRequests); n == 0 || stats[badKey].BlockedUntil.Before(time.Now()) {
+		t.Errorf("expect the blocked proxy to be tried and ejected, requests: %d, stats: %+v", n, stats[badKey])
+	}
+
+	state := translator.State()
+	if len(state.Cookies) != 0 || len(state.Tkk) != 0 {
+		t.Errorf("expect nothing obtained directly, got: %+v", state)
+	}
+	if s := state.Proxies[goodKey]; len(s.Cookies) != 1 || len(s.Tkk) != 1 {
+		t.Errorf("expect the good proxy to keep its cookie and tkk, got: %+v", s)
+	}
+}
+
+func TestNoProxy(t *testing.T) {
+	bad, _ := newForwardProxy(t, true)
+	badURL, _ := url.Parse(bad.URL)
+	badURL.User = url.UserPassword("user", "secret")
+
+	translator := NewWithOptions(
+		WithServiceURLs("http://translate.example.com"),
+		WithHostPolicy(transcookie.AnyHost),
+		WithProxies(badURL),
+	)
+	defer translator.Close()
+	_, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+	if err != ErrNoProxy {
+		t.Errorf("expect ErrNoProxy, got: %v", err)
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	good, _ := newForwardProxy(t, false)
+	goodURL, _ := url.Parse(good.URL)
+	goodURL.User = url.UserPassword("user", "secret")
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL, _ := url.Parse(dead.URL)
+	dead.Close()
+
+	defer func(intn func(int) int) { randIntn = intn }(randIntn)
+	randIntn = func(int) int { return 0 }
+
+	// a service url the host policy rejects isn't the proxies' fault
+	translator := NewWithOptions(
+		WithServiceURLs("https://translate.example.com"),
+		WithProxies(goodURL),
+	)
+	defer translator.Close()
+	if _, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"}); err != transcookie.ErrInvalidServiceURL {
+		t.Errorf("expect transcookie.ErrInvalidServiceURL, got: %v", err)
+	}
+	if stats := translator.ProxyStats(); len(stats) != 0 {
+		t.Errorf("expect no proxy to be ejected, got: %+v", stats)
+	}
+
+	// a dead proxy is ejected right away
+	translator = newTestTranslator(srv, WithProxies(deadURL, goodURL))
+	defer translator.Close()
+	start := time.Now()
+	if _, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > proxyDialTimeout {
+		t.Errorf("the dead proxy held the translation for %v", time.Since(start))
+	}
+	if stats := translator.ProxyStats()["http://"+deadURL.Host]; stats.BlockedUntil.Before(time.Now()) {
+		t.Errorf("expect the dead proxy to be ejected, stats: %+v", stats)
+	}
+}
+
+// trust makes the transports cloned from http.DefaultTransport trust srv's certificate
+// until the test ends
+func trust(t *testing.T, srv *httptest.Server) {
+	transport := http.DefaultTransport.(*http.Transport)
+	config := transport.TLSClientConfig
+	transport.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	t.Cleanup(func() { transport.TLSClientConfig = config })
+}
+
+// newConnectProxy starts an http proxy tunnelling the CONNECT requests
+// of user:secret, counting the tunnels it opens
+func newConnectProxy(t *testing.T) (*url.URL, *int64) {
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if user, password, ok := proxyAuth(r); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		atomic.AddInt64(&n, 1)
+		conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		tunnel(conn, buf, target)
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	u.User = url.UserPassword("user", "secret")
+	return u, &n
+}
+
+// newSocks5Proxy starts a socks5 proxy for user:secret, counting the connections it opens
+func newSocks5Proxy(t *testing.T) (*url.URL, *int64) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var n int64
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				target, err := socks5Handshake(conn)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				atomic.AddInt64(&n, 1)
+				tunnel(conn, conn, target)
+			}()
+		}
+	}()
+	return &url.URL{Scheme: "socks5", Host: l.Addr().String(), User: url.UserPassword("user", "secret")}, &n
+}
+
+// socks5Handshake authenticates the client of conn with username and password (RFC 1929)
+// and connects to the address it asks for (RFC 1928)
+func socks5Handshake(conn net.Conn) (net.Conn, error) {
+	var err error
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		if err == nil {
+			_, err = io.ReadFull(conn, b)
+		}
+		return b
+	}
+
+	// version, methods
+	if greeting := read(2); err != nil || greeting[0] != 5 || bytes.IndexByte(read(int(greeting[1])), 2) < 0 {
+		conn.Write([]byte{5, 0xff})
+		return nil, fmt.Errorf("no username and password method, %v", err)
+	}
+	conn.Write([]byte{5, 2})
+	// version, username, password
+	user := read(int(read(2)[1]))
+	password := read(int(read(1)[0]))
+	if err != nil || string(user) != "user" || string(password) != "secret" {
+		conn.Write([]byte{1, 1})
+		return nil, fmt.Errorf("wrong credentials, %v", err)
+	}
+	conn.Write([]byte{1, 0})
+
+	// version, connect, reserved, address type, address, port
+	var host string
+	switch request := read(4); request[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		host = string(read(int(read(1)[0])))
+	case 4:
+		host = net.IP(read(16)).String()
+	}
+	port := read(2)
+	if err != nil {
+		return nil, err
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(int(port[0])<<8|int(port[1]))))
+	if err != nil {
+		conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return target, nil
+}
+
+// tunnel copies from client, which reads what conn received, to target and back,
+// then closes both connections
+func tunnel(conn net.Conn, client io.Reader, target net.Conn) {
+	go func() {
+		io.Copy(target, client)
+		target.Close()
+	}()
+	io.Copy(conn, target)
+	conn.Close()
+}
+
+func TestConnectProxy(t *testing.T) {
+	fake := newTestServer()
+	defer fake.Close()
+	srv := httptest.NewTLSServer(fake.Config.Handler)
+	defer srv.Close()
+	trust(t, srv)
+	proxy, tunnels := newConnectProxy(t)
+
+	translator := newTestTranslator(fake, WithServiceURLs(srv.URL), WithProxies(proxy))
+	defer translator.Close()
+	translated, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: goText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(translated.Text, "Go是") || fake.Requests() != 1 || atomic.LoadInt64(tunnels) == 0 {
+		t.Errorf("expect the translation through the tunnel, got: %+v, %d tunnels", translated, atomic.LoadInt64(tunnels))
+	}
+
+	// a proxy refusing the credentials is ejected
+	proxy.User = url.UserPassword("user", "wrong")
+	translator = newTestTranslator(fake, WithServiceURLs(srv.URL), WithProxies(proxy))
+	defer translator.Close()
+	if _, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: goText}); err != ErrNoProxy {
+		t.Errorf("expect ErrNoProxy, got: %v", err)
+	}
+}
+
+func TestSocks5Proxy(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	proxy, conns := newSocks5Proxy(t)
+
+	translator := newTestTranslator(srv, WithProxies(proxy))
+	defer translator.Close()
+	translated, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: goText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(translated.Text, "Go是") || srv.Requests() != 1 || atomic.LoadInt64(conns) == 0 {
+		t.Errorf("expect the translation through the proxy, got: %+v, %d connections", translated, atomic.LoadInt64(conns))
+	}
+	if stats := translator.ProxyStats()["socks5://user@"+proxy.Host]; stats.Successes != 1 {
+		t.Errorf("expect a success through the proxy, got: %+v", stats)
+	}
+
+	proxy.User = url.UserPassword("user", "wrong")
+	translator = newTestTranslator(srv, WithProxies(proxy))
+	defer translator.Close()
+	if _, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: goText}); err != ErrNoProxy {
+		t.Errorf("expect ErrNoProxy, got: %v", err)
+	}
+}
+
+func TestProxyErrorAfterStatus(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	srv.Inject(googletranstest.Forbidden)
+	good, _ := newForwardProxy(t, false)
+	goodURL, _ := url.Parse(good.URL)
+	goodURL.User = url.UserPassword("user", "secret")
+	var dead []*url.URL
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		u, _ := url.Parse(srv.URL)
+		srv.Close()
+		dead = append(dead, u)
+	}
+
+	// the good proxy gets a 403, then each dead proxy is tried
+	defer func(intn func(int) int) { randIntn = intn }(randIntn)
+	var picks int
+	randIntn = func(n int) int {
+		if picks++; picks > n-1 {
+			return n - 1
+		}
+		return picks - 1
+	}
+	translator := newTestTranslator(srv, WithProxies(goodURL, dead[0], dead[1]))
+	defer translator.Close()
+	_, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"})
+	if err == nil || strings.Contains(err.Error(), "403") || !transportError(err) {
+		t.Errorf("expect the error of the last proxy, got: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package pseudo pseudo-localizes text, so that truncation, hard-coded strings
+// and layouts that can't handle right-to-left text show up without translations
+package pseudo
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	rlo = '\u202e' // right-to-left override
+	pdf = '\u202c' // pop directional formatting
+)
+
+var (
+	// DefaultPlaceholders matches {name}, {{name}}, printf verbs like %s, %-5d and %[1]d,
+	// html tags and entities, which are left as they are,
+	// the space flag isn't accepted so that "50 % done" keeps its "% d" translatable
+	DefaultPlaceholders = regexp.MustCompile(`\{\{[^{}]*\}\}|\{[^{}]*\}|%[-+#0]*(\[\d+\])?\d*(\.\d+)?[a-zA-Z%]|<[^<>]+>|&#?\w+;`)
+
+	accents = map[rune]rune{}
+)
+
+func init() {
+	plain := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	accented := []rune("ȦƁƇḒḖƑƓĦĪĴĶĿḾȠǾƤɊŘŞŦŬṼẆẊẎẐȧƀƈḓḗƒɠħīĵķŀḿƞǿƥɋřşŧŭṽẇẋẏẑ")
+	for i, r := range plain {
+		accents[r] = accented[i]
+	}
+}
+
+// Localizer pseudo-localizes text deterministically
+type Localizer struct {
+	accents      bool
+	expansion    float64
+	open, close  string
+	rtl          bool
+	placeholders *regexp.Regexp
+}
+
+// Option configures a Localizer
+type Option func(*Localizer)
+
+// WithAccents sets whether latin letters are replaced by accented ones, true by default
+func WithAccents(accents bool) Option {
+	return func(l *Localizer) {
+		l.accents = accents
+	}
+}
+
+// WithExpansion makes text longer by ratio of its length, 0.3 by default
+func WithExpansion(ratio float64) Option {
+	return func(l *Localizer) {
+		l.expansion = ratio
+	}
+}
+
+// WithBrackets sets the markers text is put between, "[" and "]" by default
+func WithBrackets(open, close string) Option {
+	return func(l *Localizer) {
+		l.open = open
+		l.close = close
+	}
+}
+
+// WithRTL makes every word display right to left
+func WithRTL() Option {
+	return func(l *Localizer) {
+		l.rtl = true
+	}
+}
+
+// WithPlaceholders sets the placeholders left as they are, DefaultPlaceholders by default,
+// nil leaves none
+func WithPlaceholders(placeholders *regexp.Regexp) Option {
+	return func(l *Localizer) {
+		l.placeholders = placeholders
+	}
+}
+
+// New initializes a Localizer
+func New(opts ...Option) *Localizer {
+	l := &Localizer{
+		accents:      true,
+		expansion:    0.3,
+		open:         "[",
+		close:        "]",
+		placeholders: DefaultPlaceholders,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Localize pseudo-localizes text
+func (l *Localizer) Localize(text string) string {
+	var (
+		b     strings.Builder
+		n     int // runes localized
+		start int
+	)
+	b.Grow(len(text) * 2)
+	b.WriteString(l.open)
+	if l.placeholders != nil {
+		for _, loc := range l.placeholders.FindAllStringIndex(text, -1) {
+			n += l.localize(&b, text[start:loc[0]])
+			b.WriteString(text[loc[0]:loc[1]])
+			start = loc[1]
+		}
+	}
+	n += l.localize(&b, text[start:])
+	if pad := int(math.Ceil(float64(n) * l.expansion)); pad > 0 {
+		b.WriteString(strings.Repeat("~", pad))
+	}
+	b.WriteString(l.close)
+	return b.String()
+}
+
+// localize writes s pseudo-localized to b and returns its number of runes
+func (l *Localizer) localize(b *strings.Builder, s string) int {
+	var inWord bool
+	for _, r := range s {
+		space := unicode.IsSpace(r)
+		if l.rtl && !space && !inWord {
+			b.WriteRune(rlo)
+		}
+		if l.rtl && space && inWord {
+			b.WriteRune(pdf)
+		}
+		inWord = !space
+
+		if accented, ok := accents[r]; ok && l.accents {
+			r = accented
+		}
+		b.WriteRune(r)
+	}
+	if l.rtl && inWord {
+		b.WriteRune(pdf)
+	}
+	return utf8.RuneCountInString(s)
+}
@@ -0,0 +1,43 @@
+package pseudo
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLocalize(t *testing.T) {
+	cases := []struct {
+		name   string
+		opts   []Option
+		text   string
+		expect string
+	}{
+		{"default", nil, "Hello", "[Ħḗŀŀǿ~~]"},
+		{"empty", nil, "", "[]"},
+		{"not latin", nil, "你好 123", "[你好 123~~]"},
+		{
+			"placeholders", nil,
+			"Hi {name}, %d new <b>messages</b> &amp; {{count}} %[1]s",
+			"[Ħī {name}, %d ƞḗẇ <b>ḿḗşşȧɠḗş</b> &amp; {{count}} %[1]s~~~~~~~]",
+		},
+		{"percent sign", []Option{WithExpansion(0)}, "50 % done", "[50 % ḓǿƞḗ]"},
+		{"no placeholders", []Option{WithPlaceholders(nil)}, "{a}", "[{ȧ}~]"},
+		{"custom placeholders", []Option{WithPlaceholders(regexp.MustCompile(`\$\w+`))}, "$user ok", "[$user ǿķ~]"},
+		{"no expansion", []Option{WithExpansion(0)}, "Hello", "[Ħḗŀŀǿ]"},
+		{"double length", []Option{WithExpansion(1)}, "Hello", "[Ħḗŀŀǿ~~~~~]"},
+		{"brackets", []Option{WithBrackets("⟦", "⟧"), WithExpansion(0)}, "Hello", "⟦Ħḗŀŀǿ⟧"},
+		{"no accents", []Option{WithAccents(false), WithBrackets("", ""), WithExpansion(0)}, "Hello", "Hello"},
+		{
+			"rtl", []Option{WithRTL(), WithExpansion(0)},
+			"Hello {name} world",
+			"[\u202eĦḗŀŀǿ\u202c {name} \u202eẇǿřŀḓ\u202c]",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := New(c.opts...).Localize(c.text); got != c.expect {
+				t.Errorf("expect: %q, got: %q", c.expect, got)
+			}
+		})
+	}
+}
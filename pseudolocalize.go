@@ -0,0 +1,27 @@
+package googletrans
+
+import (
+	"github.com/mind1949/googletrans/pseudo"
+)
+
+// WithPseudo makes a Translator pseudo-localize text offline with localizer
+// instead of translating it, whatever the destination language,
+// for example: WithPseudo(pseudo.New(pseudo.WithExpansion(0.5)))
+func WithPseudo(localizer *pseudo.Localizer) Option {
+	return func(t *Translator) {
+		t.pseudo = localizer
+	}
+}
+
+// pseudoTranslate pseudo-localizes params.Text,
+// its language is params.Src, or english when it's to be detected
+func (t *Translator) pseudoTranslate(params TranslateParams) rawTranslated {
+	var result rawTranslated
+	result.translated.text = t.pseudo.Localize(params.Text)
+	result.detected.originalLanguage = params.Src
+	if params.Src == "" || params.Src == "auto" {
+		result.detected.originalLanguage = "en"
+	}
+	result.detected.confidence = 1
+	return result
+}
@@ -0,0 +1,187 @@
+package googletrans
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mind1949/googletrans/tkk"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+// route reaches service hosts either directly or through one proxy,
+// and keeps the cookies and tkk obtained that way,
+// since google ties them to the address they were issued to
+type route struct {
+	proxy     *url.URL // nil for the direct route
+	key       string   // identifies the proxy in stats, state and store keys
+	clt       *http.Client
+	ownClient bool // clt was created for r, close closes its idle connections
+	jar       http.CookieJar
+	cookies   *transcookie.Cache
+	signer    Signer
+	newCache  func(serviceURL string) tkk.Cache
+	store     StateStore
+
+	m         sync.RWMutex
+	tkkCaches map[string]tkk.Cache // keyed by service host, created lazily
+}
+
+// newRoute initializes the direct route
+func (t *Translator) newRoute(clt *http.Client, jar http.CookieJar) *route {
+	return t.newProxyRoute(nil, clt, jar)
+}
+
+// newProxyRoute initializes a route through proxy,
+// which may be an http, https or socks5 url with credentials
+func (t *Translator) newProxyRoute(proxy *url.URL, clt *http.Client, jar http.CookieJar) *route {
+	ownClient := clt == nil
+	if ownClient {
+		clt = &http.Client{Transport: t.transport(proxy), CheckRedirect: checkRedirect}
+	}
+	r := &route{
+		proxy:     proxy,
+		key:       proxyKey(proxy),
+		clt:       clt,
+		ownClient: ownClient,
+		jar:       jar,
+		signer:    t.signer,
+		newCache:  t.newCache,
+		store:     t.store,
+		tkkCaches: make(map[string]tkk.Cache),
+	}
+	r.cookies = transcookie.NewCache(
+		transcookie.WithJar(jar),
+		transcookie.WithHostPolicy(t.policy),
+		transcookie.WithClient(r.clt),
+	)
+	if r.newCache == nil {
+		r.newCache = func(serviceURL string) tkk.Cache {
+			opts := []tkk.Option{tkk.WithClient(r.clt), tkk.WithPageCheck(checkPage)}
+			if r.proxy != nil {
+				// don't wait a minute for a dead proxy
+				opts = append(opts, tkk.WithTimeout(proxyTkkTimeout))
+			}
+			return tkk.NewCache(serviceURL, opts...)
+		}
+	}
+	if r.store != nil {
+		r.newCache = withStateStore(r.newCache, r.store, r.storeKey)
+	}
+	if r.signer == nil {
+		r.signer = TkkSigner(r.tkkCache)
+	}
+	return r
+}
+
+// proxyKey is proxy without its password, "" for the direct route
+func proxyKey(proxy *url.URL) string {
+	if proxy == nil {
+		return ""
+	}
+	key := proxy.Scheme + "://"
+	if proxy.User != nil {
+		key += proxy.User.Username() + "@"
+	}
+	return key + proxy.Host
+}
+
+// storeKey is the StateStore key of serviceURL's state obtained through r
+func (r *route) storeKey(serviceURL string) string {
+	if r.proxy == nil {
+		return serviceURL
+	}
+	return r.key + " " + serviceURL
+}
+
+// tkkCache returns serviceURL's tkk cache, creating it on first use
+func (r *route) tkkCache(serviceURL string) tkk.Cache {
+	r.m.RLock()
+	cache, ok := r.tkkCaches[serviceURL]
+	r.m.RUnlock()
+	if ok {
+		return cache
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if cache, ok = r.tkkCaches[serviceURL]; !ok {
+		cache = r.newCache(serviceURL)
+		r.tkkCaches[serviceURL] = cache
+	}
+	return cache
+}
+
+// invalidateTkk invalidates serviceURL's tkk cache if it has been created
+func (r *route) invalidateTkk(serviceURL string) {
+	r.m.RLock()
+	cache, ok := r.tkkCaches[serviceURL]
+	r.m.RUnlock()
+	if invalidator, isInvalidator := cache.(tkk.Invalidator); ok && isInvalidator {
+		invalidator.Invalidate()
+	}
+}
+
+// close stops the background work of r's tkk caches
+// and closes the idle connections of the client created for r
+func (r *route) close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.ownClient {
+		r.clt.CloseIdleConnections()
+	}
+	var err error
+	for serviceURL, cache := range r.tkkCaches {
+		if closer, ok := cache.(io.Closer); ok {
+			if e := closer.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		delete(r.tkkCaches, serviceURL)
+	}
+	return err
+}
+
+// getCookies gets serviceURL's cookies, looking them up in the store
+// before fetching them and storing the fetched ones
+func (r *route) getCookies(ctx context.Context, serviceURL string) ([]*http.Cookie, error) {
+	jar, ok := r.jar.(*transcookie.Jar)
+	if r.store == nil || !ok {
+		return r.cookies.GetContext(ctx, serviceURL)
+	}
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, err
+	}
+	if !r.cookies.Cached(serviceURL) {
+		if entries, err := r.store.LoadCookies(r.storeKey(serviceURL)); err == nil {
+			jar.SetEntries(entries)
+		}
+	}
+	if r.cookies.Cached(serviceURL) {
+		return r.cookies.GetContext(ctx, serviceURL)
+	}
+
+	cookies, err := r.cookies.GetContext(ctx, serviceURL)
+	if err == nil {
+		r.store.StoreCookies(r.storeKey(serviceURL), jar.EntriesFor(u))
+	}
+	return cookies, err
+}
+
+// updateCookies refetches serviceURL's cookies and stores them
+func (r *route) updateCookies(ctx context.Context, serviceURL string, sleep time.Duration) error {
+	_, err := r.cookies.UpdateContext(ctx, serviceURL, sleep)
+	if err != nil {
+		return err
+	}
+	if jar, ok := r.jar.(*transcookie.Jar); ok && r.store != nil {
+		if u, err := url.Parse(serviceURL); err == nil {
+			r.store.StoreCookies(r.storeKey(serviceURL), jar.EntriesFor(u))
+		}
+	}
+	return nil
+}
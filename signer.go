@@ -0,0 +1,77 @@
+package googletrans
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/mind1949/googletrans/tk"
+	"github.com/mind1949/googletrans/tkk"
+)
+
+// NoopSigner adds nothing to translation requests,
+// for endpoints that don't check tk
+var NoopSigner Signer = SignerFunc(func(serviceURL, text string, query url.Values) error {
+	return nil
+})
+
+// Signer attaches auth parameters to translation requests
+type Signer interface {
+	// Sign adds the parameters authorizing serviceURL to translate text to query
+	Sign(serviceURL, text string, query url.Values) error
+}
+
+// SignerFunc is an adapter to allow the use of ordinary functions as Signer
+type SignerFunc func(serviceURL, text string, query url.Values) error
+
+// Sign calls f(serviceURL, text, query)
+func (f SignerFunc) Sign(serviceURL, text string, query url.Values) error {
+	return f(serviceURL, text, query)
+}
+
+// TkkSigner signs translation requests with the tk of text,
+// computed from the tkk that cache returns for serviceURL
+func TkkSigner(cache func(serviceURL string) tkk.Cache) Signer {
+	return &tkkSigner{
+		cache:      cache,
+		generators: make(map[string]tkkGenerator),
+	}
+}
+
+// tkkSigner keeps a tk.Generator per service url,
+// parsing tkk again only when it changes
+type tkkSigner struct {
+	cache func(serviceURL string) tkk.Cache
+
+	m          sync.RWMutex
+	generators map[string]tkkGenerator // keyed by service url
+}
+
+// tkkGenerator is a tk.Generator and the tkk it was parsed from
+type tkkGenerator struct {
+	tkk       string
+	generator *tk.Generator
+}
+
+// Sign adds the tk of text to query
+func (s *tkkSigner) Sign(serviceURL, text string, query url.Values) error {
+	tkk, err := s.cache(serviceURL).Get()
+	if err != nil {
+		return err
+	}
+
+	s.m.RLock()
+	g, ok := s.generators[serviceURL]
+	s.m.RUnlock()
+	if !ok || g.tkk != tkk {
+		generator, err := tk.NewGenerator(tkk)
+		if err != nil {
+			return err
+		}
+		g = tkkGenerator{tkk: tkk, generator: generator}
+		s.m.Lock()
+		s.generators[serviceURL] = g
+		s.m.Unlock()
+	}
+	query.Set("tk", g.generator.Get(text))
+	return nil
+}
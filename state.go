@@ -0,0 +1,151 @@
+package googletrans
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mind1949/googletrans/tkk"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+// State is the session state of a Translator,
+// saving it lets a new process skip the cookie fetch and the tkk scrape
+type State struct {
+	Cookies []transcookie.Entry  `json:"cookies,omitempty"` // only saved from a transcookie.Jar
+	Tkk     map[string]TkkState  `json:"tkk,omitempty"`     // keyed by scheme://host
+	Hosts   map[string]HostStats `json:"hosts,omitempty"`   // keyed by scheme://host
+
+	Proxies map[string]ProxyState `json:"proxies,omitempty"` // keyed by proxy url without password
+}
+
+// ProxyState is the session state obtained through a proxy
+type ProxyState struct {
+	Cookies []transcookie.Entry `json:"cookies,omitempty"`
+	Tkk     map[string]TkkState `json:"tkk,omitempty"`
+	Stats   HostStats           `json:"stats"`
+}
+
+// TkkState is the tkk of a service host
+type TkkState struct {
+	Value string `json:"value"`
+	Hour  int64  `json:"hour"` // hours since the unix epoch the tkk is valid in
+}
+
+// State returns t's session state
+func (t *Translator) State() State {
+	state := State{Hosts: t.health.stats()}
+	state.Cookies, state.Tkk = t.direct.state()
+	if len(t.routes) > 0 {
+		stats := t.proxyHealth.stats()
+		state.Proxies = make(map[string]ProxyState, len(t.routes))
+		for _, r := range t.routes {
+			s := ProxyState{Stats: stats[r.key]}
+			s.Cookies, s.Tkk = r.state()
+			state.Proxies[r.key] = s
+		}
+	}
+	return state
+}
+
+// SetState restores state into t,
+// tkk values and cookies are only used while they are valid
+func (t *Translator) SetState(state State) {
+	t.direct.setState(state.Cookies, state.Tkk)
+	t.health.restore(state.Hosts)
+	for _, r := range t.routes {
+		s, ok := state.Proxies[r.key]
+		if !ok {
+			continue
+		}
+		r.setState(s.Cookies, s.Tkk)
+		t.proxyHealth.restore(map[string]HostStats{r.key: s.Stats})
+	}
+}
+
+// state returns the cookies and tkk values obtained through r
+func (r *route) state() ([]transcookie.Entry, map[string]TkkState) {
+	var cookies []transcookie.Entry
+	if jar, ok := r.jar.(*transcookie.Jar); ok {
+		cookies = jar.Entries()
+	}
+
+	tkks := make(map[string]TkkState)
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for serviceURL, cache := range r.tkkCaches {
+		snapshotter, ok := cache.(tkk.Snapshotter)
+		if !ok {
+			continue
+		}
+		value, ok := snapshotter.Snapshot()
+		if !ok {
+			continue
+		}
+		hour, _ := tkk.Hour(value)
+		tkks[serviceURL] = TkkState{Value: value, Hour: hour}
+	}
+	return cookies, tkks
+}
+
+// setState restores cookies and tkk values into r
+func (r *route) setState(cookies []transcookie.Entry, tkks map[string]TkkState) {
+	if jar, ok := r.jar.(*transcookie.Jar); ok {
+		jar.SetEntries(cookies)
+	}
+	for serviceURL, s := range tkks {
+		if snapshotter, ok := r.tkkCache(serviceURL).(tkk.Snapshotter); ok {
+			snapshotter.Restore(s.Value)
+		}
+	}
+}
+
+// SaveState writes t's session state to w as json
+func (t *Translator) SaveState(w io.Writer) error {
+	return json.NewEncoder(w).Encode(t.State())
+}
+
+// LoadState reads a session state written by SaveState from r into t
+func (t *Translator) LoadState(r io.Reader) error {
+	var state State
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	t.SetState(state)
+	return nil
+}
+
+// SaveStateFile atomically replaces the file name with t's session state
+func (t *Translator) SaveStateFile(name string) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = t.SaveState(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// LoadStateFile loads the session state saved in the file name into t,
+// a missing file isn't an error, there is just nothing to restore
+func (t *Translator) LoadStateFile(name string) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return t.LoadState(f)
+}
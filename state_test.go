@@ -0,0 +1,63 @@
+package googletrans
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+func TestSaveState(t *testing.T) {
+	var pageRequests int32
+	fake := newTestServer()
+	defer fake.Close()
+	srv := newWrappedServer(fake, func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.URL.Path == "/" {
+			atomic.AddInt32(&pageRequests, 1)
+		}
+		next.ServeHTTP(w, r)
+	})
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "state.json")
+
+	newTranslator := func() *Translator {
+		return NewWithOptions(WithServiceURLs(srv.URL), WithHostPolicy(transcookie.AnyHost))
+	}
+	params := TranslateParams{Dest: "zh-CN", Text: "hello"}
+
+	a := newTranslator()
+	if err := a.LoadStateFile(name); err != nil {
+		t.Fatalf("a missing state file should be ignored, got: %v", err)
+	}
+	if _, err := a.Translate(params); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SaveStateFile(name); err != nil {
+		t.Fatal(err)
+	}
+	fetched := atomic.LoadInt32(&pageRequests)
+
+	b := newTranslator()
+	if err := b.LoadStateFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Translate(params); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&pageRequests); got != fetched {
+		t.Errorf("expect the restored translator not to fetch cookies or tkk, got %d page requests", got-fetched)
+	}
+	if stats := b.Stats()[srv.URL]; stats.Successes != 2 {
+		t.Errorf("expect restored stats plus one success, got: %+v", stats)
+	}
+}
@@ -0,0 +1,228 @@
+package googletrans
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mind1949/googletrans/tkk"
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+var (
+	// ErrRateLimited means the rate limit of a service host has been reached
+	ErrRateLimited = errors.New("rate limit of translation service reached")
+)
+
+// StateStore shares cookies, tkk values and rate-limit counters
+// between Translators, which may live in different processes
+type StateStore interface {
+	// LoadTkk returns the tkk stored for serviceURL
+	LoadTkk(serviceURL string) (tkk string, ok bool, err error)
+	// StoreTkk stores serviceURL's tkk
+	StoreTkk(serviceURL, tkk string) error
+	// LoadCookies returns the cookies stored for serviceURL
+	LoadCookies(serviceURL string) ([]transcookie.Entry, error)
+	// StoreCookies replaces the cookies stored for serviceURL
+	StoreCookies(serviceURL string, cookies []transcookie.Entry) error
+	// Incr increments the counter key of the current fixed window
+	// and returns its new value
+	Incr(key string, window time.Duration) (int64, error)
+}
+
+// counter counts within the fixed window starting at Window
+type counter struct {
+	Window int64 `json:"window"` // unix nano
+	Count  int64 `json:"count"`
+}
+
+func (c *counter) incr(now time.Time, window time.Duration) int64 {
+	start := now.Truncate(window).UnixNano()
+	if c.Window != start {
+		c.Window, c.Count = start, 0
+	}
+	c.Count++
+	return c.Count
+}
+
+// MemoryStore is a StateStore shared by the Translators of one process
+type MemoryStore struct {
+	m        sync.Mutex
+	tkk      map[string]string
+	cookies  map[string][]transcookie.Entry
+	counters map[string]*counter
+}
+
+// NewMemoryStore initializes an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tkk:      make(map[string]string),
+		cookies:  make(map[string][]transcookie.Entry),
+		counters: make(map[string]*counter),
+	}
+}
+
+// LoadTkk returns the tkk stored for serviceURL
+func (s *MemoryStore) LoadTkk(serviceURL string) (string, bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	tkk, ok := s.tkk[serviceURL]
+	return tkk, ok, nil
+}
+
+// StoreTkk stores serviceURL's tkk
+func (s *MemoryStore) StoreTkk(serviceURL, tkk string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.tkk[serviceURL] = tkk
+	return nil
+}
+
+// LoadCookies returns the cookies stored for serviceURL
+func (s *MemoryStore) LoadCookies(serviceURL string) ([]transcookie.Entry, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]transcookie.Entry(nil), s.cookies[serviceURL]...), nil
+}
+
+// StoreCookies replaces the cookies stored for serviceURL
+func (s *MemoryStore) StoreCookies(serviceURL string, cookies []transcookie.Entry) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.cookies[serviceURL] = append([]transcookie.Entry(nil), cookies...)
+	return nil
+}
+
+// Incr increments the counter key of the current fixed window
+func (s *MemoryStore) Incr(key string, window time.Duration) (int64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	c, ok := s.counters[key]
+	if !ok {
+		c = &counter{}
+		s.counters[key] = c
+	}
+	return c.incr(time.Now(), window), nil
+}
+
+// WithStateStore shares cookies and tkk values with other Translators through store,
+// cookies are only shared if the Translator keeps them in a transcookie.Jar
+func WithStateStore(store StateStore) Option {
+	return func(t *Translator) {
+		t.store = store
+	}
+}
+
+// WithRateLimit limits the requests sent to each service host to limit per window,
+// they are counted in the StateStore if there is one so that all its Translators
+// share the limit, beyond it requests fail with ErrRateLimited
+func WithRateLimit(limit int64, window time.Duration) Option {
+	return func(t *Translator) {
+		t.limit = limit
+		t.window = window
+	}
+}
+
+// storeTkkCache looks up tkk in a StateStore before fetching it,
+// and stores the tkk it fetches
+type storeTkkCache struct {
+	tkk.Cache
+	snapshotter tkk.Snapshotter
+	key         string // store key
+	store       StateStore
+
+	m    sync.Mutex
+	skip bool // skip the store until the next fetch, its tkk was rejected
+}
+
+// withStateStore wraps the caches newCache creates with store,
+// storeKey maps service urls to store keys
+func withStateStore(newCache func(serviceURL string) tkk.Cache, store StateStore, storeKey func(serviceURL string) string) func(serviceURL string) tkk.Cache {
+	return func(serviceURL string) tkk.Cache {
+		cache := newCache(serviceURL)
+		snapshotter, ok := cache.(tkk.Snapshotter)
+		if !ok {
+			// for example a static tkk, there is nothing to share
+			return cache
+		}
+		return &storeTkkCache{
+			Cache:       cache,
+			snapshotter: snapshotter,
+			key:         storeKey(serviceURL),
+			store:       store,
+		}
+	}
+}
+
+// Get gets tkk from the cache, then from the store, and fetches it at last
+func (c *storeTkkCache) Get() (string, error) {
+	if v, ok := c.snapshotter.Snapshot(); ok {
+		return v, nil
+	}
+	c.m.Lock()
+	skip := c.skip
+	c.m.Unlock()
+	if v, ok, err := c.store.LoadTkk(c.key); err == nil && ok && !skip {
+		c.snapshotter.Restore(v)
+		if v, ok := c.snapshotter.Snapshot(); ok {
+			return v, nil
+		}
+	}
+
+	v, err := c.Cache.Get()
+	if err != nil {
+		return "", err
+	}
+	c.m.Lock()
+	c.skip = false
+	c.m.Unlock()
+	// failing to share tkk doesn't fail the translation,
+	// the fetched tkk replaces a rejected one for every store user
+	c.store.StoreTkk(c.key, v)
+	return v, nil
+}
+
+// Invalidate implements tkk.Invalidator,
+// the next Get fetches tkk rather than loading the rejected one from the store
+func (c *storeTkkCache) Invalidate() {
+	if invalidator, ok := c.Cache.(tkk.Invalidator); ok {
+		invalidator.Invalidate()
+	}
+	c.m.Lock()
+	c.skip = true
+	c.m.Unlock()
+}
+
+// Close implements io.Closer
+func (c *storeTkkCache) Close() error {
+	if closer, ok := c.Cache.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Snapshot implements tkk.Snapshotter
+func (c *storeTkkCache) Snapshot() (string, bool) {
+	return c.snapshotter.Snapshot()
+}
+
+// Restore implements tkk.Snapshotter
+func (c *storeTkkCache) Restore(v string) {
+	c.snapshotter.Restore(v)
+}
+
+// allow counts a request to serviceURL against the rate limit
+func (t *Translator) allow(serviceURL string) error {
+	if t.limit <= 0 {
+		return nil
+	}
+	n, err := t.counters.Incr("requests "+serviceURL, t.window)
+	if err != nil {
+		return err
+	}
+	if n > t.limit {
+		return ErrRateLimited
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package googletrans
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/transcookie"
+)
+
+func TestStateStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stores := map[string]StateStore{
+		"memory": NewMemoryStore(),
+		"file":   NewFileStore(filepath.Join(dir, "store.json")),
+	}
+	for name, store := range stores {
+		if _, ok, err := store.LoadTkk("https://translate.google.cn"); err != nil || ok {
+			t.Errorf("%s: expect no tkk, got: %v, %v", name, ok, err)
+		}
+		if err := store.StoreTkk("https://translate.google.cn", "443916.547221231"); err != nil {
+			t.Fatal(err)
+		}
+		if tkk, ok, err := store.LoadTkk("https://translate.google.cn"); err != nil || !ok || tkk != "443916.547221231" {
+			t.Errorf("%s: wrong tkk: %q, %v, %v", name, tkk, ok, err)
+		}
+
+		entries := []transcookie.Entry{{Name: "NID", Value: "204", Domain: "google.cn", Path: "/"}}
+		if err := store.StoreCookies("https://translate.google.cn", entries); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.LoadCookies("https://translate.google.cn")
+		if err != nil || len(got) != 1 || got[0] != entries[0] {
+			t.Errorf("%s: wrong cookies: %+v, %v", name, got, err)
+		}
+
+		for i := int64(1); i <= 3; i++ {
+			if n, err := store.Incr("requests", time.Hour); err != nil || n != i {
+				t.Errorf("%s: expect counter %d, got: %d, %v", name, i, n, err)
+			}
+		}
+	}
+}
+
+func TestFileStoreConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "store.json")
+
+	// two stores on one file behave like two processes
+	stores := []StateStore{NewFileStore(name), NewFileStore(name)}
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(store StateStore) {
+			defer wg.Done()
+			if _, err := store.Incr("requests", time.Hour); err != nil {
+				t.Error(err)
+			}
+		}(stores[i%2])
+	}
+	wg.Wait()
+
+	if n, err := stores[0].Incr("requests", time.Hour); err != nil || n != 41 {
+		t.Errorf("expect no lost increments, got: %d, %v", n, err)
+	}
+}
+
+func TestFileStoreCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "googletrans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "store.json")
+	if err := ioutil.WriteFile(name, []byte(`{"tkk":{"https://translate.google.cn":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewFileStore(name)
+	if _, ok, err := store.LoadTkk("https://translate.google.cn"); err != nil || ok {
+		t.Errorf("expect a corrupted file to be taken for an empty one, got: %v, %v", ok, err)
+	}
+	if err := store.StoreTkk("https://translate.google.cn", "443916.547221231"); err != nil {
+		t.Fatal(err)
+	}
+	if tkk, ok, err := store.LoadTkk("https://translate.google.cn"); err != nil || !ok || tkk != "443916.547221231" {
+		t.Errorf("expect the corrupted file to be replaced, got: %q, %v, %v", tkk, ok, err)
+	}
+}
+
+func TestWithStateStore(t *testing.T) {
+	var pageRequests int32
+	fake := newTestServer()
+	defer fake.Close()
+	srv := newWrappedServer(fake, func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.URL.Path == "/" {
+			atomic.AddInt32(&pageRequests, 1)
+		}
+		next.ServeHTTP(w, r)
+	})
+	defer srv.Close()
+
+	store := NewMemoryStore()
+	newTranslator := func() *Translator {
+		return NewWithOptions(
+			WithServiceURLs(srv.URL),
+			WithHostPolicy(transcookie.AnyHost),
+			WithStateStore(store),
+			WithRateLimit(2, time.Hour),
+		)
+	}
+	params := TranslateParams{Dest: "zh-CN", Text: "hello"}
+
+	if _, err := newTranslator().Translate(params); err != nil {
+		t.Fatal(err)
+	}
+	fetched := atomic.LoadInt32(&pageRequests)
+	if _, err := newTranslator().Translate(params); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&pageRequests); got != fetched {
+		t.Errorf("expect the second translator to use the stored cookies and tkk, got %d page requests", got-fetched)
+	}
+
+	// the rate limit is shared too
+	if _, err := newTranslator().Translate(params); err != ErrRateLimited {
+		t.Errorf("expect ErrRateLimited, got: %v", err)
+	}
+}
+
+func TestWithStateStoreInvalidate(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	// the stored tkk belongs to the current hour but the service rejects it
+	store := NewMemoryStore()
+	rejected := fmt.Sprintf("%d.999", time.Now().Unix()/3600)
+	store.StoreTkk(srv.URL, rejected)
+	translator := newTestTranslator(srv, WithStateStore(store))
+	defer translator.Close()
+
+	if _, err := translator.Translate(TranslateParams{Dest: "zh-CN", Text: "hello"}); err != nil {
+		t.Fatalf("expect tkk to be fetched after the stored one was rejected, got: %v", err)
+	}
+	if v, _, _ := store.LoadTkk(srv.URL); v != srv.Tkk() {
+		t.Errorf("expect the fetched tkk to replace the rejected one, expect: %q, got: %q", srv.Tkk(), v)
+	}
+}
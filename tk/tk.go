@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
@@ -14,104 +15,124 @@ var (
 
 // Get generates google translate tk
 func Get(s string, tkk string) (tk string, err error) {
-	_, err = strconv.ParseFloat(tkk, 64)
+	g, err := NewGenerator(tkk)
 	if err != nil {
-		return "", ErrInvalidTkk
+		return "", err
 	}
+	return g.Get(s), nil
+}
 
-	var a []int
-	for _, vRune := range s {
-		v := int(vRune)
-		if v < 0x10000 {
-			a = append(a, v)
-		} else {
-			a = append(a, (v-0x10000)/0x400+0xD800)
-			a = append(a, (v-0x10000)%0x400+0xDC00)
-		}
-	}
+// Generator generates google translate tk from a tkk parsed once,
+// it's safe for concurrent use
+//
+// All arithmetic is done on uint32 to mirror the javascript implementation,
+// whose bitwise operators work on 32-bit integers, so tk doesn't depend on
+// the size of int of the target platform.
+type Generator struct {
+	tkkl uint32 // the part of tkk before '.'
+	tkkr uint32 // the part of tkk after '.'
+}
 
-	var e []int
-	for g := 0; g < len(a); g++ {
-		l := a[g]
-		if l < 128 {
-			e = append(e, l)
-		} else {
-			if l < 2048 {
-				e = append(e, l>>6|192)
-			} else {
-				if (l&64512) == 55296 && g+1 < len(a) && a[g+1]&64512 == 56320 {
-					g++
-					l = 65536 + ((l & 1023) << 10) + (a[g] & 1023)
-					e = append(e, l>>18|240)
-					e = append(e, l>>12&63|128)
-				} else {
-					e = append(e, l>>12|224)
-				}
-				e = append(e, l>>6&63|128)
-			}
-			e = append(e, l&63|128)
-		}
+// NewGenerator parses tkk into a Generator
+func NewGenerator(tkk string) (*Generator, error) {
+	_, err := strconv.ParseFloat(tkk, 64)
+	if err != nil {
+		return nil, ErrInvalidTkk
 	}
 
-	var (
-		tkkl     int
-		tkkpaire []int
-	)
-	for _, str := range strings.Split(tkk, ".") {
-		tkkpaire = append(tkkpaire, s2int(str))
-	}
-	if len(tkkpaire) > 1 {
-		tkkl = tkkpaire[0]
+	g := &Generator{}
+	if i := strings.IndexByte(tkk, '.'); i >= 0 {
+		g.tkkl = s2uint32(tkk[:i])
+		g.tkkr = s2uint32(tkk[i+1:])
+	} else {
+		g.tkkl = s2uint32(tkk)
 	}
+	return g, nil
+}
+
+// Get generates tk of s
+func (g *Generator) Get(s string) string {
+	var buf [24]byte
+	return string(g.Append(buf[:0], s))
+}
 
-	var tkklc = tkkl
-	for i := 0; i < len(e); i++ {
-		tkklc += e[i]
-		tkklc = xr(tkklc, "+-a^+6")
+// Append appends tk of s to dst and returns the extended buffer,
+// it doesn't allocate if dst has enough capacity
+func (g *Generator) Append(dst []byte, s string) []byte {
+	a := g.tkkl
+	for _, r := range s {
+		a = g.add(a, r)
 	}
-	tkklc = xr(tkklc, "+-3^+b+-f")
+	return g.append(dst, a)
+}
 
-	if len(tkkpaire) > 1 {
-		tkklc ^= tkkpaire[1]
-	} else {
-		tkklc ^= 0
+// AppendBytes is like Append but takes the text as utf-8 encoded bytes
+func (g *Generator) AppendBytes(dst []byte, b []byte) []byte {
+	a := g.tkkl
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		a = g.add(a, r)
+		b = b[size:]
 	}
+	return g.append(dst, a)
+}
 
-	if tkklc < 0 {
-		tkklc = (tkklc & 2147483647) + 2147483648
+// add mixes r's utf-8 bytes into a, for valid text they are exactly
+// the bytes the javascript implementation derives from utf-16 code units
+func (*Generator) add(a uint32, r rune) uint32 {
+	var e [utf8.UTFMax]byte
+	n := utf8.EncodeRune(e[:], r)
+	for i := 0; i < n; i++ {
+		a += uint32(e[i])
+		a = xr(a, "+-a^+6")
 	}
+	return a
+}
+
+func (g *Generator) append(dst []byte, a uint32) []byte {
+	a = xr(a, "+-3^+b+-f")
+	a ^= g.tkkr
 
-	tkklc %= 1000000
+	// javascript maps a negative int32 to its uint32 value here,
+	// which a already is
+	a %= 1000000
 
-	return strconv.Itoa(tkklc) + "." + strconv.Itoa(tkklc^tkkl), nil
+	dst = strconv.AppendUint(dst, uint64(a), 10)
+	dst = append(dst, '.')
+	return strconv.AppendInt(dst, int64(int32(a^g.tkkl)), 10)
 }
 
-func xr(a int, b string) int {
+// xr applies the operations encoded in b to a, three bytes per operation:
+// '+' adds and '^' xors, then '+' shifts right (>>>) and '-' shifts left
+// by the digit, 'a' to 'f' standing for 10 to 15
+func xr(a uint32, b string) uint32 {
 	for c := 0; c < len(b)-2; c += 3 {
-		d := string(b[c+2])
-		var dd int
-		if "a" <= d {
-			dd = int(d[0]) - 87
+		d := uint(b[c+2])
+		if 'a' <= d {
+			d -= 87
 		} else {
-			dd = s2int(d)
+			d -= '0'
 		}
 
-		if "+" == string(b[c+1]) {
-			dd = (a % 0x100000000) >> dd
+		var dd uint32
+		if '+' == b[c+1] {
+			dd = a >> d
 		} else {
-			dd = a << dd
+			dd = a << d
 		}
 
-		if "+" == string(b[c]) {
-			a = (a + dd) & 4294967295
+		if '+' == b[c] {
+			a += dd
 		} else {
-			a = a ^ dd
+			a ^= dd
 		}
 	}
 	return a
 }
 
-func s2int(s string) int {
-	i, _ := strconv.Atoi(s)
-	return i
+// s2uint32 converts s to uint32 the way javascript's ToUint32 does,
+// keeping the low 32 bits
+func s2uint32(s string) uint32 {
+	i, _ := strconv.ParseInt(s, 10, 64)
+	return uint32(i)
 }
@@ -0,0 +1,39 @@
+package tk
+
+import "testing"
+
+var benchText = "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. "
+
+func BenchmarkGet(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Get(benchText, "443916.547221231")
+	}
+}
+
+func BenchmarkGeneratorGet(b *testing.B) {
+	g, _ := NewGenerator("443916.547221231")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		g.Get(benchText)
+	}
+}
+
+func BenchmarkGeneratorAppend(b *testing.B) {
+	g, _ := NewGenerator("443916.547221231")
+	buf := make([]byte, 0, 32)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = g.Append(buf[:0], benchText)
+	}
+}
+
+func BenchmarkGeneratorAppendBytes(b *testing.B) {
+	g, _ := NewGenerator("443916.547221231")
+	text := []byte(benchText)
+	buf := make([]byte, 0, 32)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = g.AppendBytes(buf[:0], text)
+	}
+}
@@ -15,3 +15,84 @@ func TestGet(t *testing.T) {
 		t.Errorf("wrong tk, expect: %q, got: %q", expect, tk)
 	}
 }
+
+// vectors are generated by the javascript implementation,
+// run `GOARCH=386 go test` to check them under 32-bit int as well
+var vectors = []struct {
+	text string
+	tkk  string
+	tk   string
+}{
+	{"", "443916.547221231", "190237.270609"},
+	{"a", "443916.547221231", "593745.1034589"},
+	{"hello world", "443916.547221231", "933502.587890"},
+	{"hello\u00A0world", "443916.547221231", "68957.510801"},
+	{"Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. ", "443916.547221231", "211170.392942"},
+	{"Go是一种开放源代码编程语言", "443916.547221231", "404607.60019"},
+	{"Привет, мир", "443916.547221231", "638783.1014067"},
+	{"emoji \U0001F600 \U0001F1E8\U0001F1F3", "443916.547221231", "346714.232534"},
+	{"hello world", "406194.2357858072", "191032.317578"},
+	{"Go是一种开放源代码编程语言", "406194.2357858072", "477340.96814"},
+	{"emoji \U0001F600 \U0001F1E8\U0001F1F3", "406194.2357858072", "391662.248668"},
+	{"Привет, мир", "427110.1469889687", "64453.425891"},
+	{"", "0.0", "0.0"},
+	{"hello world", "0.0", "60183.60183"},
+	{"hello\u00A0world", "445678.4294967295", "440323.29933"},
+	{"Go is an open source programming language that makes it easy to build simple, reliable, and efficient software. ", "445678.4294967295", "155002.299412"},
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range vectors {
+		g, err := NewGenerator(v.tkk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tk := g.Get(v.text); tk != v.tk {
+			t.Errorf("Get(%q, %q): expect: %q, got: %q", v.text, v.tkk, v.tk, tk)
+		}
+		if tk := string(g.AppendBytes(nil, []byte(v.text))); tk != v.tk {
+			t.Errorf("AppendBytes(%q, %q): expect: %q, got: %q", v.text, v.tkk, v.tk, tk)
+		}
+	}
+
+	if _, err := NewGenerator("tkk"); err != ErrInvalidTkk {
+		t.Errorf("expect ErrInvalidTkk, got: %v", err)
+	}
+}
+
+func TestXr(t *testing.T) {
+	// values near the 32-bit boundaries, where int overflowed on 32-bit platforms
+	cases := []struct {
+		a, expect uint32
+		b         string
+	}{
+		{0, 0, "+-a^+6"},
+		{1, 1041, "+-a^+6"},
+		{4294967295, 4227859472, "+-a^+6"},
+		{2147483648, 2181038080, "+-a^+6"},
+		{4294967295, 4293132296, "+-3^+b+-f"},
+		{2147483648, 2148532224, "+-3^+b+-f"},
+	}
+	for _, c := range cases {
+		if got := xr(c.a, c.b); got != c.expect {
+			t.Errorf("xr(%d, %q): expect: %d, got: %d", c.a, c.b, c.expect, got)
+		}
+	}
+}
+
+func TestGeneratorAllocs(t *testing.T) {
+	g, err := NewGenerator("443916.547221231")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "Go是一种开放源代码编程语言 \U0001F600"
+	b := []byte(text)
+	buf := make([]byte, 0, 32)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = g.Append(buf[:0], text)
+		buf = g.AppendBytes(buf[:0], b)
+	})
+	if allocs != 0 {
+		t.Errorf("expect no allocations, got: %v", allocs)
+	}
+}
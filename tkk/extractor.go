@@ -0,0 +1,103 @@
+package tkk
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DefaultExtractor tries every known google translation page format
+	DefaultExtractor = MultiExtractor(
+		RegexpExtractor(tkkRegexp),
+		RegexpExtractor(regexp.MustCompile(`TKK='(\d+\.\d+)'`)),
+		EvalExtractor,
+	)
+
+	// EvalExtractor extracts tkk from the hex-encoded arithmetic of
+	// TKK=eval('((function(){var a\x3d3567445460;var b\x3d-1209587388;return 406194+\x27.\x27+(a+b)})())');
+	EvalExtractor Extractor = ExtractorFunc(extractEval)
+
+	evalRegexp       = regexp.MustCompile(`TKK=eval\('((?:\\.|[^'\\])*)'\)`)
+	evalVarRegexp    = regexp.MustCompile(`var (\w+)=(-?\d+)`)
+	evalReturnRegexp = regexp.MustCompile(`return (\d+)\+'\.'\+\((\w+)([+\-^])(\w+)\)`)
+	hexEscapeRegexp  = regexp.MustCompile(`\\x([0-9a-fA-F]{2})`)
+)
+
+// Extractor extracts tkk from google translation page
+type Extractor interface {
+	Extract(page []byte) (tkk string, err error)
+}
+
+// ExtractorFunc is an adapter to allow the use of ordinary functions as Extractor
+type ExtractorFunc func(page []byte) (tkk string, err error)
+
+// Extract calls f(page)
+func (f ExtractorFunc) Extract(page []byte) (string, error) {
+	return f(page)
+}
+
+// RegexpExtractor extracts tkk from re's first submatch
+func RegexpExtractor(re *regexp.Regexp) Extractor {
+	return ExtractorFunc(func(page []byte) (string, error) {
+		matched := re.FindSubmatch(page)
+		if len(matched) < 2 {
+			return "", ErrNotFound
+		}
+		return string(matched[1]), nil
+	})
+}
+
+// MultiExtractor returns an Extractor that tries extractors in order
+// and returns the first tkk found
+func MultiExtractor(extractors ...Extractor) Extractor {
+	return ExtractorFunc(func(page []byte) (string, error) {
+		for _, extractor := range extractors {
+			tkk, err := extractor.Extract(page)
+			if err == nil {
+				return tkk, nil
+			}
+		}
+		return "", ErrNotFound
+	})
+}
+
+func extractEval(page []byte) (string, error) {
+	matched := evalRegexp.FindSubmatch(page)
+	if len(matched) < 2 {
+		return "", ErrNotFound
+	}
+	code := hexEscapeRegexp.ReplaceAllStringFunc(string(matched[1]), func(escaped string) string {
+		b, _ := strconv.ParseUint(escaped[2:], 16, 8)
+		return string(rune(b))
+	})
+	code = strings.Replace(code, `\'`, `'`, -1)
+
+	vars := make(map[string]int64)
+	for _, v := range evalVarRegexp.FindAllStringSubmatch(code, -1) {
+		vars[v[1]], _ = strconv.ParseInt(v[2], 10, 64)
+	}
+	ret := evalReturnRegexp.FindStringSubmatch(code)
+	if ret == nil {
+		return "", ErrNotFound
+	}
+	a, ok := vars[ret[2]]
+	if !ok {
+		return "", ErrNotFound
+	}
+	b, ok := vars[ret[4]]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	var v int64
+	switch ret[3] {
+	case "+":
+		v = a + b
+	case "-":
+		v = a - b
+	case "^":
+		v = a ^ b
+	}
+	return ret[1] + "." + strconv.FormatInt(v, 10), nil
+}
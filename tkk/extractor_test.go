@@ -0,0 +1,55 @@
+package tkk
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDefaultExtractor(t *testing.T) {
+	cases := []struct {
+		name   string
+		page   string
+		expect string
+	}{
+		{
+			name:   "tkk",
+			page:   `window.WIZ_global_data={ttsUrl:'/translate_tts',tkk:'443916.547221231',zwAKxb:''};`,
+			expect: "443916.547221231",
+		},
+		{
+			name:   "TKK",
+			page:   `c._ctkk=true;TKK='427110.1469889687';MSG_TRANSLATE="Translate";`,
+			expect: "427110.1469889687",
+		},
+		{
+			name:   "TKK=eval",
+			page:   `;TKK=eval('((function(){var a\x3d3567445460;var b\x3d-1209587388;return 406194+\x27.\x27+(a+b)})())');`,
+			expect: "406194.2357858072",
+		},
+	}
+	for _, c := range cases {
+		tkk, err := DefaultExtractor.Extract([]byte(c.page))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if tkk != c.expect {
+			t.Errorf("%s: wrong tkk, expect: %q, got: %q", c.name, c.expect, tkk)
+		}
+	}
+
+	if _, err := DefaultExtractor.Extract([]byte("<html></html>")); err != ErrNotFound {
+		t.Errorf("expect ErrNotFound, got: %v", err)
+	}
+}
+
+func TestRegexpExtractor(t *testing.T) {
+	extractor := RegexpExtractor(regexp.MustCompile(`"tkk":"(\d+\.\d+)"`))
+	tkk, err := extractor.Extract([]byte(`{"tkk":"443916.547221231"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "443916.547221231"; tkk != expect {
+		t.Errorf("wrong tkk, expect: %q, got: %q", expect, tkk)
+	}
+}
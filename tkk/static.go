@@ -0,0 +1,40 @@
+package tkk
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Static returns a Cache that always returns tkk and never fetches,
+// for example when google translation page can't be scraped
+func Static(tkk string) Cache {
+	return staticCache(tkk)
+}
+
+// FromHTML extracts tkk from a saved google translation page
+// and returns a Static cache of it
+func FromHTML(r io.Reader) (Cache, error) {
+	page, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tkk, err := DefaultExtractor.Extract(page)
+	if err != nil {
+		return nil, err
+	}
+
+	return Static(tkk), nil
+}
+
+type staticCache string
+
+// Set is a no-op, a static cache never fetches
+func (staticCache) Set(googleTransURL string) {}
+
+// Get gets tkk
+func (s staticCache) Get() (string, error) {
+	return string(s), nil
+}
+
+// Invalidate is a no-op, a static cache has nothing to refetch
+func (staticCache) Invalidate() {}
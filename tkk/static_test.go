@@ -0,0 +1,38 @@
+package tkk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatic(t *testing.T) {
+	cache := Static("443916.547221231")
+	cache.Set("https://translate.google.com")
+	cache.(Invalidator).Invalidate()
+	tkk, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "443916.547221231"; tkk != expect {
+		t.Errorf("wrong tkk, expect: %q, got: %q", expect, tkk)
+	}
+}
+
+func TestFromHTML(t *testing.T) {
+	page := `<html><script>window.WIZ_global_data={tkk:'443916.547221231'};</script></html>`
+	cache, err := FromHTML(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tkk, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "443916.547221231"; tkk != expect {
+		t.Errorf("wrong tkk, expect: %q, got: %q", expect, tkk)
+	}
+
+	if _, err := FromHTML(strings.NewReader("<html></html>")); err != ErrNotFound {
+		t.Errorf("expect ErrNotFound, got: %v", err)
+	}
+}
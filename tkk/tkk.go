@@ -31,6 +31,10 @@ var (
 	// ErrNotFound couldn't found tkk
 	ErrNotFound = errors.New("couldn't found tkk from google translation url")
 
+	// ErrCaptcha means google answered with its captcha page instead,
+	// Get returns errors wrapping it right away rather than retrying
+	ErrCaptcha = errors.New("google translation url answered with a captcha page")
+
 	tkkRegexp = regexp.MustCompile(`tkk:'(\d+\.\d+)'`)
 )
 
@@ -40,21 +44,112 @@ type Cache interface {
 	Get() (tkk string, err error)
 }
 
+// Invalidator is implemented by caches whose tkk can be discarded,
+// for example after the service rejected it
+type Invalidator interface {
+	// Invalidate discards the cached tkk, the next Get will fetch a new one
+	Invalidate()
+}
+
+// Snapshotter is implemented by caches whose tkk can be saved and restored,
+// for example across process restarts
+type Snapshotter interface {
+	// Snapshot returns the cached tkk if it's still valid
+	Snapshot() (tkk string, ok bool)
+	// Restore caches a previously saved tkk, which is used while it's valid
+	Restore(tkk string)
+}
+
+// Hour returns the hour since the unix epoch tkk belongs to,
+// a tkk is only valid during that hour
+func Hour(tkk string) (int64, bool) {
+	return hourOf(tkk)
+}
+
+// Option configures a cache created by NewCache
+type Option func(*tkkCache)
+
+// WithClient sets the http client used to fetch google translation page
+func WithClient(clt *http.Client) Option {
+	return func(t *tkkCache) {
+		t.clt = clt
+	}
+}
+
+// WithTimeout sets how long an update keeps retrying before giving up
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *tkkCache) {
+		t.timeout = timeout
+	}
+}
+
+// WithRetryInterval sets how long an update sleeps between two failed fetches
+func WithRetryInterval(interval time.Duration) Option {
+	return func(t *tkkCache) {
+		t.sleep = interval
+	}
+}
+
+// WithExtractor sets how tkk is extracted from google translation page
+func WithExtractor(extractor Extractor) Option {
+	return func(t *tkkCache) {
+		t.extractor = extractor
+	}
+}
+
+// WithRefresh starts a background refresher that fetches the next hour's tkk
+// ahead of the hourly rollover. If the refresh fails, the previous tkk keeps
+// being served for grace after the rollover. The cache then implements
+// io.Closer, call Close to stop the refresher.
+func WithRefresh(ahead, grace time.Duration) Option {
+	return func(t *tkkCache) {
+		t.refresh = true
+		t.ahead = ahead
+		t.grace = grace
+	}
+}
+
+// WithPageCheck sets a check run on every fetched google translation page
+// before tkk is extracted from it, for example returning ErrCaptcha
+// when the page is a captcha
+func WithPageCheck(check func(resp *http.Response, page []byte) error) Option {
+	return func(t *tkkCache) {
+		t.check = check
+	}
+}
+
+// withClock replaces time.Now, for testing
+func withClock(now func() time.Time) Option {
+	return func(t *tkkCache) {
+		t.now = now
+	}
+}
+
 // NewCache initializes a cache
-func NewCache(serviceURL string) Cache {
+func NewCache(serviceURL string, opts ...Option) Cache {
 	if serviceURL == "" {
 		serviceURL = defaultServiceURL
 	}
 
-	token := make(chan struct{}, 1)
-	token <- struct{}{}
 	cache := &tkkCache{
 		v: "0",
 		u: serviceURL,
 
-		m:     &sync.RWMutex{},
-		cond:  sync.NewCond(&sync.Mutex{}),
-		token: token,
+		clt:       http.DefaultClient,
+		sleep:     1 * time.Second,
+		timeout:   1 * time.Minute,
+		extractor: DefaultExtractor,
+		now:       time.Now,
+
+		m: &sync.RWMutex{},
+	}
+	for _, opt := range opts {
+		opt(cache)
+	}
+	if cache.refresh {
+		cache.done = make(chan struct{})
+		cache.stopped = make(chan struct{})
+		go cache.refresher()
 	}
 
 	return cache
@@ -64,118 +159,238 @@ type tkkCache struct {
 	v string // google translate tkk
 	u string // google translation url
 
-	m     *sync.RWMutex
-	cond  *sync.Cond
-	token chan struct{} // update token
+	clt       *http.Client
+	sleep     time.Duration // interval between two failed fetches
+	timeout   time.Duration // how long an update keeps retrying
+	extractor Extractor
+	check     func(resp *http.Response, page []byte) error // nil if pages aren't checked
+	now       func() time.Time
+
+	next    string        // the next hour's tkk fetched by the refresher
+	refresh bool          // whether the background refresher runs
+	ahead   time.Duration // how long before the rollover the refresher fetches
+	grace   time.Duration // how long the previous tkk is served after the rollover
+	done    chan struct{} // closed by Close to stop the refresher
+	stopped chan struct{} // closed when the refresher returns
+	once    sync.Once
+
+	m      *sync.RWMutex
+	flight *tkkUpdate // the update in flight, nil if there is none
+}
+
+// tkkUpdate is an update of a tkkCache, done is closed when it ends
+type tkkUpdate struct {
+	u    string // the google translation url it fetches from
+	done chan struct{}
+	tkk  string
+	err  error
 }
 
 // Set sets google translation url
 func (t *tkkCache) Set(googleTransURL string) {
-	t.u = googleTransURL
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.u != googleTransURL {
+		t.u = googleTransURL
+		t.v = "0"
+		t.next = "0"
+	}
 }
 
 // Get gets tkk
 func (t *tkkCache) Get() (tkk string, err error) {
 	t.m.RLock()
-	isvalid := t.isvalid()
+	tkk, isvalid := t.valid()
 	t.m.RUnlock()
 	if isvalid {
-		return t.v, nil
+		return tkk, nil
 	}
 
 	return t.update()
 }
 
-func (t *tkkCache) isvalid() bool {
-	now := math.Floor(float64(
-		time.Now().Unix() * 1000 / 3600000),
-	)
-	ttkf64, err := strconv.ParseFloat(t.v, 64)
-	if err != nil {
-		return false
-	}
-	if now != math.Floor(ttkf64) {
-		return false
+// Invalidate discards the cached tkk
+func (t *tkkCache) Invalidate() {
+	t.m.Lock()
+	t.v = "0"
+	t.next = "0"
+	t.m.Unlock()
+}
+
+// Close stops the background refresher
+func (t *tkkCache) Close() error {
+	if !t.refresh {
+		return nil
 	}
+	t.once.Do(func() {
+		close(t.done)
+	})
+	<-t.stopped
+	return nil
+}
 
-	return true
+// Snapshot returns the cached tkk if it's still valid
+func (t *tkkCache) Snapshot() (string, bool) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return t.valid()
 }
 
-// update gets tkk from t.u
-func (t *tkkCache) update() (string, error) {
-	// only one goroutine is allowed to obtain the update token at the same time
-	// other goroutines can only wait until the update of this goroutine ends
-	select {
-	case <-t.token:
-		// no-op
-	default:
-		t.cond.L.Lock()
-		defer t.cond.L.Unlock()
-		t.cond.Wait()
-		if t.isvalid() {
-			return t.v, nil
-		}
-		<-t.token
+// Restore caches tkk unless a tkk of the same or a later hour is cached
+func (t *tkkCache) Restore(tkk string) {
+	h, ok := hourOf(tkk)
+	if !ok {
+		return
 	}
 	t.m.Lock()
-	defer func() {
-		t.m.Unlock()
-		t.token <- struct{}{}
-	}()
+	defer t.m.Unlock()
+	if current, ok := hourOf(t.v); !ok || current < h {
+		t.v = tkk
+	}
+}
 
-	// try to get tkk within timeout
-	var (
-		start   = time.Now()
-		sleep   = 1 * time.Second
-		timeout = 1 * time.Minute
-
-		err error
-	)
-	for time.Now().Sub(start) < timeout {
-		t.v, err = func() (string, error) {
-			req, err := http.NewRequest(http.MethodGet, t.u, nil)
-			if err != nil {
-				return "", err
-			}
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				return "", err
-			}
-			defer resp.Body.Close()
+// valid returns the tkk of the current hour,
+// or the previous hour's tkk while it is within the grace period
+func (t *tkkCache) valid() (string, bool) {
+	now := t.now()
+	hour := now.Unix() / 3600
+	if h, ok := hourOf(t.next); ok && h == hour {
+		return t.next, true
+	}
+	h, ok := hourOf(t.v)
+	if !ok {
+		return "", false
+	}
+	if h == hour {
+		return t.v, true
+	}
+	if h+1 == hour && now.Sub(time.Unix(hour*3600, 0)) < t.grace {
+		return t.v, true
+	}
 
-			if resp.StatusCode >= 400 {
-				format := "couldn't found tkk from google translation url, status code: %d"
-				err = fmt.Errorf(format, resp.StatusCode)
-				return "", err
-			}
+	return "", false
+}
+
+// hourOf returns the hour tkk belongs to
+func hourOf(tkk string) (int64, bool) {
+	f, err := strconv.ParseFloat(tkk, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(math.Floor(f)), true
+}
+
+// refresher fetches the next hour's tkk ahead of every rollover,
+// retrying until it succeeds or the grace period ends
+func (t *tkkCache) refresher() {
+	defer close(t.stopped)
+
+	next := t.now().Unix()/3600 + 1
+	for {
+		rollover := time.Unix(next*3600, 0)
+		select {
+		case <-t.done:
+			return
+		case <-time.After(rollover.Add(-t.ahead).Sub(t.now())):
+		}
 
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return "", err
+		for t.now().Before(rollover.Add(t.grace)) {
+			t.m.RLock()
+			u := t.u
+			t.m.RUnlock()
+			tkk, err := t.fetch(u)
+			if h, ok := hourOf(tkk); err == nil && ok && h >= next-1 {
+				t.m.Lock()
+				if h >= next {
+					t.next = tkk
+				} else {
+					t.v = tkk
+				}
+				t.m.Unlock()
+				if h >= next {
+					break
+				}
 			}
-			data := string(body)
-			if !tkkRegexp.MatchString(data) {
-				return "", ErrNotFound
+
+			select {
+			case <-t.done:
+				return
+			case <-time.After(t.sleep):
 			}
+		}
+
+		if hour := t.now().Unix() / 3600; next <= hour {
+			next = hour + 1
+		} else {
+			next++
+		}
+	}
+}
 
-			tkk := tkkRegexp.FindStringSubmatch(data)[1]
-			return tkk, nil
-		}()
-		if err == nil {
-			// if the update is successful,
-			// notify all goroutines waiting for the update
-			t.cond.Broadcast()
-			return t.v, nil
+// update gets tkk from t.u, only one goroutine fetches it at the same time,
+// the others wait for the update in flight and get its result
+func (t *tkkCache) update() (string, error) {
+	t.m.Lock()
+	if tkk, ok := t.valid(); ok {
+		t.m.Unlock()
+		return tkk, nil
+	}
+	if f := t.flight; f != nil && f.u == t.u {
+		t.m.Unlock()
+		<-f.done
+		return f.tkk, f.err
+	}
+	f := &tkkUpdate{u: t.u, done: make(chan struct{})}
+	t.flight = f
+	t.m.Unlock()
+
+	// try to get tkk within timeout
+	for start := t.now(); ; time.Sleep(t.sleep) {
+		f.tkk, f.err = t.fetch(f.u)
+		// retrying a captcha only makes the block last longer
+		if f.err == nil || errors.Is(f.err, ErrCaptcha) || t.now().Sub(start) >= t.timeout {
+			break
 		}
+	}
+
+	t.m.Lock()
+	if f.err == nil && t.u == f.u {
+		t.v = f.tkk
+	}
+	if t.flight == f {
+		t.flight = nil
+	}
+	t.m.Unlock()
+	close(f.done)
+	return f.tkk, f.err
+}
 
-		time.Sleep(sleep)
+// fetch gets google translation page from serviceURL and extracts tkk from it
+func (t *tkkCache) fetch(serviceURL string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, serviceURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.clt.Do(req)
+	if err != nil {
+		return "", err
 	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		// if the update fails,
-		// notify one goroutine that is waiting to perform the update
-		t.cond.Signal()
+		return "", err
+	}
+	if t.check != nil {
+		if err = t.check(resp, body); err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode >= 400 {
+		format := "couldn't found tkk from google translation url, status code: %d"
+		err = fmt.Errorf(format, resp.StatusCode)
 		return "", err
 	}
 
-	return t.v, nil
+	return t.extractor.Extract(body)
 }
@@ -1,13 +1,307 @@
 package tkk
 
-import "testing"
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/googletranstest"
+)
 
 func TestGet(t *testing.T) {
-	tkk, err := Get()
+	srv := googletranstest.NewServer()
+	defer srv.Close()
+
+	tkk, err := NewCache(srv.URL).Get()
 	if err != nil {
 		t.Error(err)
 	}
-	if tkk == "" {
-		t.Error("get invalid tkk")
+	if tkk != srv.Tkk() {
+		t.Errorf("get invalid tkk, expect: %s, got: %s", srv.Tkk(), tkk)
+	}
+}
+
+func newTkkServer(tkk func() string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<script>window.WIZ_global_data={tkk:'%s'};</script>", tkk())
+	}))
+}
+
+func currentTkk(suffix int) string {
+	return fmt.Sprintf("%d.%d", time.Now().Unix()/3600, suffix)
+}
+
+func TestSetConcurrent(t *testing.T) {
+	a := newTkkServer(func() string { return currentTkk(1) })
+	defer a.Close()
+	b := newTkkServer(func() string { return currentTkk(2) })
+	defer b.Close()
+
+	cache := NewCache(a.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				cache.Set(b.URL)
+			} else {
+				cache.Set(a.URL)
+			}
+			if _, err := cache.Get(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cache.Set(b.URL)
+	tkk, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := currentTkk(2); tkk != expect {
+		t.Errorf("wrong tkk after Set, expect: %q, got: %q", expect, tkk)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	var suffix int
+	srv := newTkkServer(func() string {
+		suffix++
+		return currentTkk(suffix)
+	})
+	defer srv.Close()
+
+	cache := NewCache(srv.URL)
+	first, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.(Invalidator).Invalidate()
+	second, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("tkk wasn't refetched after Invalidate, got: %q twice", second)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"tkk":"%s"}`, currentTkk(1))
+	}))
+	defer srv.Close()
+
+	extractor := RegexpExtractor(regexp.MustCompile(`"tkk":"(\d+\.\d+)"`))
+	cache := NewCache(srv.URL,
+		WithClient(srv.Client()),
+		WithTimeout(time.Second),
+		WithRetryInterval(time.Millisecond),
+		WithExtractor(extractor),
+	)
+	tkk, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := currentTkk(1); tkk != expect {
+		t.Errorf("wrong tkk, expect: %q, got: %q", expect, tkk)
+	}
+	if requests != 3 {
+		t.Errorf("expect 3 requests, got: %d", requests)
+	}
+
+	// the default extractor doesn't understand the page
+	cache = NewCache(srv.URL, WithTimeout(10*time.Millisecond), WithRetryInterval(time.Millisecond))
+	if _, err := cache.Get(); err != ErrNotFound {
+		t.Errorf("expect ErrNotFound once the timeout is exceeded, got: %v", err)
+	}
+}
+
+type fakeClock struct {
+	m    sync.Mutex
+	now  time.Time
+	tick time.Duration // added to now on every call
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.tick)
+	return now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.m.Lock()
+	c.now = now
+	c.m.Unlock()
+}
+
+func TestRefresh(t *testing.T) {
+	rollover := time.Unix((time.Now().Unix()/3600+1)*3600, 0)
+	clock := &fakeClock{now: rollover.Add(-30 * time.Second)}
+
+	var (
+		m        sync.Mutex
+		requests int
+		fail     bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		requests++
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// the page already serves the next hour's tkk
+		fmt.Fprintf(w, "tkk:'%d.1'", rollover.Unix()/3600)
+	}))
+	defer srv.Close()
+
+	cache := NewCache(srv.URL,
+		WithRetryInterval(time.Millisecond),
+		WithTimeout(10*time.Millisecond),
+		WithRefresh(time.Minute, time.Minute),
+		withClock(clock.Now),
+	).(*tkkCache)
+	var _ io.Closer = cache
+	defer cache.Close()
+
+	// wait for the refresher to fetch the next hour's tkk
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		cache.m.RLock()
+		next := cache.next
+		cache.m.RUnlock()
+		if next != "" {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("the refresher didn't fetch the next tkk")
+		}
+	}
+
+	m.Lock()
+	fail = true
+	before := requests
+	m.Unlock()
+
+	clock.Set(rollover.Add(time.Second))
+	tkk, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := fmt.Sprintf("%d.1", rollover.Unix()/3600); tkk != expect {
+		t.Errorf("wrong tkk after rollover, expect: %q, got: %q", expect, tkk)
+	}
+	m.Lock()
+	if requests != before {
+		t.Errorf("Get fetched the page after rollover, requests: %d, before: %d", requests, before)
+	}
+	m.Unlock()
+}
+
+func TestRefreshGrace(t *testing.T) {
+	rollover := time.Unix((time.Now().Unix()/3600+1)*3600, 0)
+	clock := &fakeClock{now: rollover.Add(-2 * time.Hour)}
+	srv := newTkkServer(func() string { return "" })
+	defer srv.Close()
+
+	cache := NewCache(srv.URL,
+		WithRetryInterval(time.Millisecond),
+		WithTimeout(10*time.Millisecond),
+		WithRefresh(time.Minute, time.Minute),
+		withClock(clock.Now),
+	).(*tkkCache)
+	defer cache.Close()
+
+	previous := fmt.Sprintf("%d.1", rollover.Unix()/3600-1)
+	cache.m.Lock()
+	cache.v = previous
+	cache.m.Unlock()
+
+	clock.Set(rollover.Add(30 * time.Second))
+	tkk, err := cache.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tkk != previous {
+		t.Errorf("expect the previous tkk within the grace period, expect: %q, got: %q", previous, tkk)
+	}
+
+	// the update times out by the clock, not by the wall clock
+	clock.Set(rollover.Add(2 * time.Minute))
+	clock.m.Lock()
+	clock.tick = 5 * time.Millisecond
+	clock.m.Unlock()
+	if _, err := cache.Get(); err == nil {
+		t.Error("expect an error once the grace period is over")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	srv := newTkkServer(func() string { return currentTkk(1) })
+	defer srv.Close()
+
+	cache := NewCache(srv.URL).(Snapshotter)
+	if _, ok := cache.Snapshot(); ok {
+		t.Error("expect no snapshot before the first Get")
+	}
+
+	cache.Restore(currentTkk(2))
+	tkk, ok := cache.Snapshot()
+	if !ok || tkk != currentTkk(2) {
+		t.Errorf("expect the restored tkk, got: %q", tkk)
+	}
+	if got, err := cache.(Cache).Get(); err != nil || got != currentTkk(2) {
+		t.Errorf("expect Get to use the restored tkk, got: %q, %v", got, err)
+	}
+
+	// an outdated tkk doesn't replace a valid one
+	cache.Restore(fmt.Sprintf("%d.3", time.Now().Unix()/3600-1))
+	if tkk, _ := cache.Snapshot(); tkk != currentTkk(2) {
+		t.Errorf("an outdated tkk replaced the valid one, got: %q", tkk)
+	}
+	if h, ok := Hour(currentTkk(2)); !ok || h != time.Now().Unix()/3600 {
+		t.Errorf("wrong hour: %d", h)
+	}
+}
+
+func TestPageCheck(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "<div class=\"g-recaptcha\"></div>")
+	}))
+	defer srv.Close()
+
+	cache := NewCache(srv.URL,
+		WithRetryInterval(time.Millisecond),
+		WithPageCheck(func(resp *http.Response, page []byte) error {
+			if strings.Contains(string(page), "g-recaptcha") {
+				return ErrCaptcha
+			}
+			return nil
+		}),
+	)
+	if _, err := cache.Get(); err != ErrCaptcha {
+		t.Errorf("expect ErrCaptcha, got: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expect a captcha not to be retried, got %d requests", requests)
 	}
 }
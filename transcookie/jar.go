@@ -0,0 +1,251 @@
+package transcookie
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Jar is an http.CookieJar that keeps every cookie of every host,
+// it honors Domain, Path, Secure, Expires and Max-Age like net/http/cookiejar
+// without a public suffix list
+type Jar struct {
+	now func() time.Time
+
+	m       sync.Mutex
+	entries map[string]map[string]Entry // keyed by domain, then by Entry.id
+}
+
+// Entry is a cookie kept in a Jar, with everything needed to restore it
+type Entry struct {
+	Name       string    `json:"name"`
+	Value      string    `json:"value"`
+	Domain     string    `json:"domain"` // without leading dot
+	Path       string    `json:"path"`
+	Secure     bool      `json:"secure,omitempty"`
+	HttpOnly   bool      `json:"http_only,omitempty"`
+	HostOnly   bool      `json:"host_only,omitempty"`  // the cookie had no Domain attribute
+	Persistent bool      `json:"persistent,omitempty"` // the cookie had Expires or Max-Age
+	Expires    time.Time `json:"expires"`              // only meaningful if Persistent
+}
+
+func (e *Entry) id() string {
+	return e.Name + ";" + e.Path
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return e.Persistent && !e.Expires.After(now)
+}
+
+// NewJar initializes an empty jar
+func NewJar() *Jar {
+	return &Jar{
+		now:     time.Now,
+		entries: make(map[string]map[string]Entry),
+	}
+}
+
+// SetCookies implements http.CookieJar
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u)
+	if host == "" {
+		return
+	}
+
+	j.m.Lock()
+	defer j.m.Unlock()
+	now := j.now()
+	for _, cookie := range cookies {
+		e, ok := newEntry(cookie, u, host, now)
+		if !ok {
+			continue
+		}
+		if j.entries[e.Domain] == nil {
+			j.entries[e.Domain] = make(map[string]Entry)
+		}
+		if e.expired(now) {
+			delete(j.entries[e.Domain], e.id())
+			continue
+		}
+		j.entries[e.Domain][e.id()] = e
+	}
+}
+
+// Cookies implements http.CookieJar,
+// it returns u's unexpired cookies with longer paths listed first
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u)
+	if host == "" {
+		return nil
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	https := u.Scheme == "https"
+
+	j.m.Lock()
+	defer j.m.Unlock()
+	now := j.now()
+	var selected []Entry
+	for domain, entries := range j.entries {
+		if !domainMatch(host, domain) {
+			continue
+		}
+		for id, e := range entries {
+			if e.expired(now) {
+				delete(entries, id)
+				continue
+			}
+			if e.HostOnly && host != domain {
+				continue
+			}
+			if e.Secure && !https {
+				continue
+			}
+			if !pathMatch(path, e.Path) {
+				continue
+			}
+			selected = append(selected, e)
+		}
+	}
+	sort.Slice(selected, func(a, b int) bool {
+		if len(selected[a].Path) != len(selected[b].Path) {
+			return len(selected[a].Path) > len(selected[b].Path)
+		}
+		return selected[a].Name < selected[b].Name
+	})
+
+	cookies := make([]*http.Cookie, 0, len(selected))
+	for _, e := range selected {
+		cookies = append(cookies, &http.Cookie{Name: e.Name, Value: e.Value})
+	}
+	return cookies
+}
+
+// Entries returns every unexpired cookie in j
+func (j *Jar) Entries() []Entry {
+	j.m.Lock()
+	defer j.m.Unlock()
+	now := j.now()
+	var entries []Entry
+	for _, domainEntries := range j.entries {
+		for _, e := range domainEntries {
+			if !e.expired(now) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].Domain != entries[b].Domain {
+			return entries[a].Domain < entries[b].Domain
+		}
+		return entries[a].id() < entries[b].id()
+	})
+	return entries
+}
+
+// EntriesFor returns the unexpired cookies in j that u's host may receive,
+// regardless of their path and Secure
+func (j *Jar) EntriesFor(u *url.URL) []Entry {
+	host := canonicalHost(u)
+	var entries []Entry
+	for _, e := range j.Entries() {
+		if domainMatch(host, e.Domain) && (!e.HostOnly || host == e.Domain) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// SetEntries adds entries to j, replacing the cookies they collide with
+func (j *Jar) SetEntries(entries []Entry) {
+	j.m.Lock()
+	defer j.m.Unlock()
+	now := j.now()
+	for _, e := range entries {
+		if e.Name == "" || e.Domain == "" || e.expired(now) {
+			continue
+		}
+		if j.entries[e.Domain] == nil {
+			j.entries[e.Domain] = make(map[string]Entry)
+		}
+		j.entries[e.Domain][e.id()] = e
+	}
+}
+
+func newEntry(cookie *http.Cookie, u *url.URL, host string, now time.Time) (Entry, bool) {
+	if cookie.Name == "" {
+		return Entry{}, false
+	}
+	e := Entry{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   host,
+		Path:     cookie.Path,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		HostOnly: true,
+	}
+
+	if domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), "."); domain != "" && domain != host {
+		// a host may only set cookies for its own domains, and not for a top level domain
+		if net.ParseIP(host) != nil || !domainMatch(host, domain) || !strings.Contains(domain, ".") {
+			return Entry{}, false
+		}
+		e.Domain = domain
+		e.HostOnly = false
+	} else if domain != "" {
+		e.HostOnly = false
+	}
+
+	if e.Path == "" || e.Path[0] != '/' {
+		e.Path = defaultPath(u.Path)
+	}
+
+	switch {
+	case cookie.MaxAge < 0:
+		e.Persistent, e.Expires = true, time.Unix(1, 0)
+	case cookie.MaxAge > 0:
+		e.Persistent, e.Expires = true, now.Add(time.Duration(cookie.MaxAge)*time.Second)
+	case !cookie.Expires.IsZero():
+		e.Persistent, e.Expires = true, cookie.Expires
+	}
+
+	return e, true
+}
+
+func canonicalHost(u *url.URL) string {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// domainMatch reports whether host is domain or one of its subdomains
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch reports whether requestPath is within cookiePath
+func pathMatch(requestPath, cookiePath string) bool {
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return len(requestPath) == len(cookiePath) ||
+		strings.HasSuffix(cookiePath, "/") ||
+		requestPath[len(cookiePath)] == '/'
+}
+
+// defaultPath is the directory of urlPath
+func defaultPath(urlPath string) string {
+	i := strings.LastIndex(urlPath, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return urlPath[:i]
+}
@@ -0,0 +1,109 @@
+package transcookie
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cookieNames(cookies []*http.Cookie) string {
+	var names []string
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func mustParse(rawurl string) *url.URL {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestJar(t *testing.T) {
+	now := time.Date(2021, 2, 25, 15, 0, 0, 0, time.UTC)
+	jar := NewJar()
+	jar.now = func() time.Time { return now }
+
+	jar.SetCookies(mustParse("https://translate.google.cn/"), []*http.Cookie{
+		{Name: "NID", Value: "204", Domain: ".google.cn", Path: "/", Expires: now.Add(time.Hour)},
+		{Name: "CONSENT", Value: "YES", Domain: ".google.cn", Path: "/"},
+		{Name: "session", Value: "1"},
+		{Name: "secure", Value: "1", Secure: true},
+		{Name: "translate", Value: "1", Path: "/translate_a"},
+		{Name: "short", Value: "1", MaxAge: 60},
+		{Name: "expired", Value: "1", Expires: now.Add(-time.Hour)},
+		{Name: "other", Value: "1", Domain: "google.com"},
+		{Name: "tld", Value: "1", Domain: "cn"},
+	})
+
+	cases := []struct {
+		url    string
+		expect string
+	}{
+		{"https://translate.google.cn/", "CONSENT NID secure session short"},
+		{"http://translate.google.cn/", "CONSENT NID session short"},
+		{"https://translate.google.cn/translate_a/single", "translate CONSENT NID secure session short"},
+		{"https://translate.google.cn/translate_abc", "CONSENT NID secure session short"},
+		{"https://www.google.cn/", "CONSENT NID"},
+		{"https://translate.google.com/", ""},
+	}
+	for _, c := range cases {
+		if got := cookieNames(jar.Cookies(mustParse(c.url))); got != c.expect {
+			t.Errorf("Cookies(%q): expect: %q, got: %q", c.url, c.expect, got)
+		}
+	}
+
+	// Max-Age and Expires
+	now = now.Add(2 * time.Minute)
+	if got, expect := cookieNames(jar.Cookies(mustParse("https://www.google.cn/"))), "CONSENT NID"; got != expect {
+		t.Errorf("expect: %q, got: %q", expect, got)
+	}
+	if got, expect := cookieNames(jar.Cookies(mustParse("https://translate.google.cn/"))), "CONSENT NID secure session"; got != expect {
+		t.Errorf("Max-Age isn't honored, expect: %q, got: %q", expect, got)
+	}
+	now = now.Add(time.Hour)
+	if got, expect := cookieNames(jar.Cookies(mustParse("https://translate.google.cn/"))), "CONSENT secure session"; got != expect {
+		t.Errorf("Expires isn't honored, expect: %q, got: %q", expect, got)
+	}
+
+	// replacing and deleting
+	jar.SetCookies(mustParse("https://translate.google.cn/"), []*http.Cookie{
+		{Name: "CONSENT", Value: "NO", Domain: ".google.cn", Path: "/"},
+		{Name: "session", Value: "1", MaxAge: -1},
+	})
+	cookies := jar.Cookies(mustParse("https://translate.google.cn/"))
+	if got, expect := cookieNames(cookies), "CONSENT secure"; got != expect {
+		t.Errorf("expect: %q, got: %q", expect, got)
+	}
+	if cookies[0].Value != "NO" {
+		t.Errorf("CONSENT isn't replaced, got: %q", cookies[0].Value)
+	}
+}
+
+func TestJarEntries(t *testing.T) {
+	u := mustParse("https://translate.google.cn/")
+	jar := NewJar()
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "NID", Value: "204", Domain: ".google.cn", Path: "/", MaxAge: 3600},
+		{Name: "session", Value: "1"},
+		{Name: "expired", Value: "1", MaxAge: -1},
+	})
+	entries := jar.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, got: %+v", entries)
+	}
+
+	restored := NewJar()
+	restored.SetEntries(entries)
+	if got, expect := cookieNames(restored.Cookies(u)), "NID session"; got != expect {
+		t.Errorf("expect: %q, got: %q", expect, got)
+	}
+	if got, expect := cookieNames(restored.Cookies(mustParse("https://www.google.cn/"))), "NID"; got != expect {
+		t.Errorf("host only isn't restored, expect: %q, got: %q", expect, got)
+	}
+}
@@ -2,136 +2,504 @@
 package transcookie
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 var (
-	defaultCookiesCache = newCache()
+	defaultCookiesCache = NewCache()
 
 	emptyCookie = http.Cookie{}
 
-	// ErrInvalidServiceURL service url is invalid
+	// ErrInvalidServiceURL service url is invalid or not allowed by the host policy
 	ErrInvalidServiceURL = errors.New("invalid translate google service url")
+
+	// ErrInvalidCookie Set-Cookie header has no cookie name
+	ErrInvalidCookie = errors.New("invalid set-cookie header")
 )
 
-// Get gets cookie from defaultCookiesCache
+// Get gets the NID cookie from defaultCookiesCache
 // for example: Get("https://translate.google.com")
+//
+// Deprecated: use GetAll, services may need more cookies than NID
 func Get(serviceURL string) (http.Cookie, error) {
-	return defaultCookiesCache.get(serviceURL)
+	cookies, err := GetAll(serviceURL)
+	if err != nil {
+		return emptyCookie, err
+	}
+	return nidCookie(cookies), nil
 }
 
-// Update updates defaultCookiesCache's cookie
+// Update updates defaultCookiesCache's cookies and returns the NID cookie
+//
+// Deprecated: use UpdateAll, services may need more cookies than NID
 func Update(serviceURL string, sleep time.Duration) (http.Cookie, error) {
-	return defaultCookiesCache.update(serviceURL, sleep)
+	cookies, err := UpdateAll(serviceURL, sleep)
+	if err != nil {
+		return emptyCookie, err
+	}
+	return nidCookie(cookies), nil
 }
 
-// transCookiesCache caches google tranlation services' cookies
-type transCookiesCache struct {
-	clt *http.Client
+// GetAll gets cookies from defaultCookiesCache
+// for example: GetAll("https://translate.google.com")
+func GetAll(serviceURL string) ([]*http.Cookie, error) {
+	return defaultCookiesCache.Get(serviceURL)
+}
 
-	m       sync.RWMutex
-	cookies map[string]http.Cookie
+// UpdateAll updates defaultCookiesCache's cookies
+func UpdateAll(serviceURL string, sleep time.Duration) ([]*http.Cookie, error) {
+	return defaultCookiesCache.Update(serviceURL, sleep)
 }
 
-func newCache() *transCookiesCache {
-	return &transCookiesCache{
-		clt:     &http.Client{},
-		cookies: make(map[string]http.Cookie),
+// nidCookie returns the NID cookie of cookies, or the first one if there is none
+func nidCookie(cookies []*http.Cookie) http.Cookie {
+	for _, cookie := range cookies {
+		if cookie.Name == "NID" {
+			return *cookie
+		}
 	}
+	if len(cookies) > 0 {
+		return *cookies[0]
+	}
+	return emptyCookie
 }
 
-func (c *transCookiesCache) get(serviceURL string) (http.Cookie, error) {
-	u, err := url.Parse(serviceURL)
-	if err != nil {
-		return emptyCookie, ErrInvalidServiceURL
+// HostPolicy reports whether cookies may be fetched from hostname
+type HostPolicy func(hostname string) bool
+
+// GoogleHosts only allows google translation hosts such as translate.google.com,
+// it's the default policy
+func GoogleHosts(hostname string) bool {
+	return len(hostname) > len("translate.google") && hostname[:len("translate.google")] == "translate.google"
+}
+
+// AnyHost allows every host,
+// for example a reverse proxy, a mirror or an httptest server
+func AnyHost(hostname string) bool {
+	return hostname != ""
+}
+
+// AllowHosts allows hostnames in addition to google translation hosts
+func AllowHosts(hostnames ...string) HostPolicy {
+	allowed := make(map[string]bool, len(hostnames))
+	for _, hostname := range hostnames {
+		allowed[hostname] = true
 	}
-	hostname := u.Hostname()
-	if len(hostname) <= len("translate.google") || hostname[:len("translate.google")] != "translate.google" {
-		return emptyCookie, ErrInvalidServiceURL
+	return func(hostname string) bool {
+		return allowed[hostname] || GoogleHosts(hostname)
 	}
+}
+
+// Option configures a Cache created by NewCache
+type Option func(*Cache)
 
-	c.m.RLock()
-	cookie, ok := c.cookies[hostname[len("translate"):]]
-	c.m.RUnlock()
-	if ok && cookie.Expires.After(time.Now()) {
-		return cookie, nil
+// WithJar sets the jar cookies are kept in
+func WithJar(jar http.CookieJar) Option {
+	return func(c *Cache) {
+		c.jar = jar
 	}
+}
 
-	return c.update(serviceURL, 0)
+// WithClient sets the http client used to fetch cookies
+func WithClient(clt *http.Client) Option {
+	return func(c *Cache) {
+		c.clt = clt
+	}
 }
 
-func (c *transCookiesCache) update(serviceURL string, sleep time.Duration) (http.Cookie, error) {
-	c.m.Lock()
-	defer c.m.Unlock()
+// WithHostPolicy sets which hosts cookies may be fetched from
+func WithHostPolicy(policy HostPolicy) Option {
+	return func(c *Cache) {
+		c.policy = policy
+	}
+}
+
+// WithRequiredCookie sets the cookie services need, Get fetches cookies
+// again once it has expired, "" means any cookie will do (default: NID)
+func WithRequiredCookie(name string) Option {
+	return func(c *Cache) {
+		c.required = name
+	}
+}
+
+// Cache caches google tranlation services' cookies in a jar
+type Cache struct {
+	clt      *http.Client
+	jar      http.CookieJar
+	policy   HostPolicy
+	required string // name of the cookie services need
+
+	m       sync.Mutex
+	flights map[string]*flight // in-flight updates keyed by scheme://host
+}
+
+// flight is an update shared by every caller updating the same host
+type flight struct {
+	done    chan struct{}
+	cookies []*http.Cookie
+	err     error
+
+	waiters int                // callers still waiting, guarded by Cache.m
+	cancel  context.CancelFunc // cancels the fetch once no caller waits
+}
+
+// NewCache initializes a cache, by default with its own Jar
+func NewCache(opts ...Option) *Cache {
+	c := &Cache{
+		clt:      &http.Client{},
+		jar:      NewJar(),
+		policy:   GoogleHosts,
+		required: "NID",
+		flights:  make(map[string]*flight),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Get gets serviceURL's cookies, fetching them if the jar has none
+// or the required cookie has expired
+func (c *Cache) Get(serviceURL string) ([]*http.Cookie, error) {
+	return c.GetContext(context.Background(), serviceURL)
+}
 
-	time.Sleep(sleep)
-	response, err := c.clt.Get(serviceURL)
+// GetContext is like Get but gives up waiting for the fetch when ctx is done
+func (c *Cache) GetContext(ctx context.Context, serviceURL string) ([]*http.Cookie, error) {
+	u, err := c.parseServiceURL(serviceURL)
 	if err != nil {
-		return emptyCookie, err
+		return nil, err
 	}
-	response.Body.Close()
-	cookieStr := response.Header.Get("Set-Cookie")
-	cookie, err := c.parseCookieStr(cookieStr)
+
+	if cookies := c.jar.Cookies(u); c.fresh(cookies) {
+		return cookies, nil
+	}
+
+	return c.UpdateContext(ctx, serviceURL, 0)
+}
+
+// Cached reports whether the jar has the cookies serviceURL needs,
+// in which case Get doesn't fetch them
+func (c *Cache) Cached(serviceURL string) bool {
+	u, err := c.parseServiceURL(serviceURL)
 	if err != nil {
-		return emptyCookie, err
+		return false
 	}
-	c.cookies[cookie.Domain] = cookie
+	return c.fresh(c.jar.Cookies(u))
+}
 
-	return cookie, nil
+// fresh reports whether cookies has the required cookie,
+// jars leave expired cookies out
+func (c *Cache) fresh(cookies []*http.Cookie) bool {
+	if c.required == "" {
+		return len(cookies) > 0
+	}
+	for _, cookie := range cookies {
+		if cookie.Name == c.required {
+			return true
+		}
+	}
+	return false
 }
 
-func (*transCookiesCache) parseCookieStr(cookieStr string) (http.Cookie, error) {
-	return parseCookieStr(cookieStr)
+// Update sleeps, then fetches serviceURL's cookies into the jar
+func (c *Cache) Update(serviceURL string, sleep time.Duration) ([]*http.Cookie, error) {
+	return c.UpdateContext(context.Background(), serviceURL, sleep)
 }
 
-// parseCookieStr
-// for example:
-// 		cookieStr="NID=204=Au7rQwn2eharnT1rtKsoQl32M2ASoamoFj5Rk8LKHZgg7YZfo54k88aqBVcUEYxcLKjpSU5dNgGTrRAu4Uiv7G3fIAeT3L87gsJCdqg_dCJ9tMHTufW8pHIUD1KgCDwUSIH60d4cWVsukZpai43pm9vHr3SLHCQk9ueEpYJ5Cx8; expires=Thu, 25-Feb-2021 15:15:28 GMT; path=/; domain=.google.cn; HttpOnly"
-func parseCookieStr(cookieStr string) (http.Cookie, error) {
-	var (
-		l, m, r int
-		cookie  = http.Cookie{HttpOnly: true}
-	)
-	for r < len(cookieStr) {
-		for m < len(cookieStr) && cookieStr[m] != '=' {
-			m++
+// UpdateContext is like Update but the sleep and the fetch are cancelled with ctx.
+// Only one update per host runs at a time, concurrent callers for the same host
+// share its result, while updates of other hosts aren't blocked. The shared update
+// is only cancelled once every caller waiting for it has given up.
+func (c *Cache) UpdateContext(ctx context.Context, serviceURL string, sleep time.Duration) ([]*http.Cookie, error) {
+	u, err := c.parseServiceURL(serviceURL)
+	if err != nil {
+		return nil, err
+	}
+	key := u.Scheme + "://" + u.Host
+
+	c.m.Lock()
+	f, ok := c.flights[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.Background())
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		c.flights[key] = f
+		go func() {
+			f.cookies, f.err = c.fetch(fctx, u, sleep)
+			c.m.Lock()
+			if c.flights[key] == f {
+				delete(c.flights, key)
+			}
+			c.m.Unlock()
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	c.m.Unlock()
+
+	select {
+	case <-f.done:
+		return f.cookies, f.err
+	case <-ctx.Done():
+		c.m.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// nobody needs the update, later callers start a new one
+			f.cancel()
+			if c.flights[key] == f {
+				delete(c.flights, key)
+			}
 		}
-		if m >= len(cookieStr) {
-			break
+		c.m.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// fetch sleeps, then fetches u's cookies into the jar
+func (c *Cache) fetch(ctx context.Context, u *url.URL, sleep time.Duration) ([]*http.Cookie, error) {
+	if sleep > 0 {
+		timer := time.NewTimer(sleep)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
 		}
-		k := cookieStr[l:m]
+	}
 
-		for r < len(cookieStr) && cookieStr[r] != ';' {
-			r++
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.clt.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	var cookies []*http.Cookie
+	for _, cookieStr := range response.Header["Set-Cookie"] {
+		cookie, err := parseCookieStr(cookieStr)
+		if err != nil {
+			// user agents ignore invalid Set-Cookie headers
+			continue
 		}
-		v := cookieStr[m+1 : r]
+		cookies = append(cookies, &cookie)
+	}
+	c.jar.SetCookies(u, cookies)
+
+	return c.jar.Cookies(u), nil
+}
+
+func (c *Cache) parseServiceURL(serviceURL string) (*url.URL, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, ErrInvalidServiceURL
+	}
+	if !c.policy(u.Hostname()) {
+		return nil, ErrInvalidServiceURL
+	}
+	return u, nil
+}
+
+// parseCookieStr parses a Set-Cookie header following RFC 6265 section 5.2,
+// unknown attributes are kept in cookie.Unparsed
+// for example:
+//
+//	cookieStr="NID=204=Au7rQwn2eharnT1rtKsoQl32M2ASoamoFj5Rk8LKHZgg7YZfo54k88aqBVcUEYxcLKjpSU5dNgGTrRAu4Uiv7G3fIAeT3L87gsJCdqg_dCJ9tMHTufW8pHIUD1KgCDwUSIH60d4cWVsukZpai43pm9vHr3SLHCQk9ueEpYJ5Cx8; expires=Thu, 25-Feb-2021 15:15:28 GMT; path=/; domain=.google.cn; HttpOnly"
+func parseCookieStr(cookieStr string) (http.Cookie, error) {
+	parts := strings.Split(cookieStr, ";")
+	name, value, ok := cut(parts[0], "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return emptyCookie, ErrInvalidCookie
+	}
+	value = strings.TrimSpace(value)
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	cookie := http.Cookie{Name: name, Value: value, Raw: cookieStr}
 
-		switch k {
+	for _, part := range parts[1:] {
+		attr, v, _ := cut(part, "=")
+		attr, v = strings.TrimSpace(attr), strings.TrimSpace(v)
+		switch strings.ToLower(attr) {
+		case "":
+			// no-op
 		case "expires":
-			var err error
-			cookie.Expires, err = time.Parse("Mon, 02-Jan-2006 15:04:05 MST", v)
-			if err != nil {
-				return emptyCookie, err
+			if expires, ok := parseCookieDate(v); ok {
+				cookie.Expires = expires
+				cookie.RawExpires = v
+			}
+		case "max-age":
+			if maxAge, ok := parseMaxAge(v); ok {
+				cookie.MaxAge = maxAge
 			}
-		case "path":
-			cookie.Path = v
 		case "domain":
-			cookie.Domain = v
+			if v != "" {
+				cookie.Domain = strings.ToLower(strings.TrimPrefix(v, "."))
+			}
+		case "path":
+			if v != "" && v[0] == '/' {
+				cookie.Path = v
+			}
+		case "secure":
+			cookie.Secure = true
+		case "httponly":
+			cookie.HttpOnly = true
+		case "samesite":
+			switch strings.ToLower(v) {
+			case "lax":
+				cookie.SameSite = http.SameSiteLaxMode
+			case "strict":
+				cookie.SameSite = http.SameSiteStrictMode
+			case "none":
+				cookie.SameSite = http.SameSiteNoneMode
+			default:
+				cookie.SameSite = http.SameSiteDefaultMode
+			}
 		default:
-			cookie.Name = k
-			cookie.Value = v
+			cookie.Unparsed = append(cookie.Unparsed, strings.TrimSpace(part))
 		}
+	}
+
+	return cookie, nil
+}
+
+// parseMaxAge parses Max-Age into http.Cookie's convention,
+// where a negative MaxAge means the cookie expires now
+func parseMaxAge(v string) (int, bool) {
+	if v == "" || (v[0] != '-' && (v[0] < '0' || v[0] > '9')) {
+		return 0, false
+	}
+	maxAge, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+	if maxAge <= 0 {
+		return -1, true
+	}
+	return maxAge, true
+}
+
+var months = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// parseCookieDate implements the cookie-date algorithm of RFC 6265 section 5.1.1,
+// which accepts every date format found in the wild, for example:
+// "Thu, 25-Feb-2021 15:15:28 GMT", "Thu, 25 Feb 2021 15:15:28 GMT",
+// "Thursday, 25-Feb-21 15:15:28 GMT" and "Thu Feb 25 15:15:28 2021"
+func parseCookieDate(v string) (time.Time, bool) {
+	var (
+		foundTime, foundDay, foundMonth, foundYear bool
 
-		for r < len(cookieStr) && (cookieStr[r] == ' ' || cookieStr[r] == ';') {
-			r++
+		hour, minute, second, day, year int
+		month                           time.Month
+	)
+	for _, token := range strings.FieldsFunc(v, isDateDelimiter) {
+		if !foundTime {
+			if h, m, s, ok := parseHMS(token); ok {
+				hour, minute, second, foundTime = h, m, s, true
+				continue
+			}
+		}
+		if !foundDay {
+			if d, ok := leadingDigits(token, 1, 2); ok {
+				day, foundDay = d, true
+				continue
+			}
+		}
+		if !foundMonth && len(token) >= 3 {
+			prefix := strings.ToLower(token[:3])
+			for i, m := range months {
+				if prefix == m {
+					month, foundMonth = time.Month(i+1), true
+					break
+				}
+			}
+			if foundMonth {
+				continue
+			}
+		}
+		if !foundYear {
+			if y, ok := leadingDigits(token, 2, 4); ok {
+				year, foundYear = y, true
+				continue
+			}
 		}
-		l = r
-		m = r
 	}
 
-	return cookie, nil
+	if 70 <= year && year <= 99 {
+		year += 1900
+	} else if 0 <= year && year <= 69 {
+		year += 2000
+	}
+	if !foundTime || !foundDay || !foundMonth || !foundYear ||
+		day < 1 || day > 31 || year < 1601 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, false
+	}
+
+	t := time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	if t.Day() != day {
+		// for example Feb 30
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// isDateDelimiter reports whether c is a delimiter of cookie-date
+func isDateDelimiter(c rune) bool {
+	return c == 0x09 ||
+		(0x20 <= c && c <= 0x2F) ||
+		(0x3B <= c && c <= 0x40) ||
+		(0x5B <= c && c <= 0x60) ||
+		(0x7B <= c && c <= 0x7E)
+}
+
+// parseHMS parses hms-time, which is 1*2DIGIT ":" 1*2DIGIT ":" 1*2DIGIT
+// optionally followed by a non-digit and anything
+func parseHMS(token string) (hour, minute, second int, ok bool) {
+	fields := strings.SplitN(token, ":", 3)
+	if len(fields) != 3 {
+		return 0, 0, 0, false
+	}
+	if hour, ok = leadingDigits(fields[0], 1, 2); !ok || strings.TrimLeft(fields[0], "0123456789") != "" {
+		return 0, 0, 0, false
+	}
+	if minute, ok = leadingDigits(fields[1], 1, 2); !ok || strings.TrimLeft(fields[1], "0123456789") != "" {
+		return 0, 0, 0, false
+	}
+	if second, ok = leadingDigits(fields[2], 1, 2); !ok {
+		return 0, 0, 0, false
+	}
+	return hour, minute, second, true
+}
+
+// leadingDigits parses the min to max digits token starts with,
+// which must not be followed by another digit
+func leadingDigits(token string, min, max int) (int, bool) {
+	n := 0
+	for n < len(token) && '0' <= token[n] && token[n] <= '9' {
+		n++
+	}
+	if n < min || n > max {
+		return 0, false
+	}
+	i, _ := strconv.Atoi(token[:n])
+	return i, true
+}
+
+// cut slices s around the first instance of sep
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
 }
@@ -1,20 +1,349 @@
 package transcookie
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mind1949/googletrans/googletranstest"
+)
 
 func TestParseCookieStr(t *testing.T) {
-	cookieStr := "NID=204=Au7rQwn2eharnT1rtKsoQl32M2ASoamoFj5Rk8LKHZgg7YZfo54k88aqBVcUEYxcLKjpSU5dNgGTrRAu4Uiv7G3fIAeT3L87gsJCdqg_dCJ9tMHTufW8pHIUD1KgCDwUSIH60d4cWVsukZpai43pm9vHr3SLHCQk9ueEpYJ5Cx8; expires=Thu, 25-Feb-2021 15:15:28 GMT; path=/; domain=.google.cn; HttpOnly"
-	cookie, err := parseCookieStr(cookieStr)
-	if err != nil {
-		t.Error(err)
+	expires := time.Date(2021, 2, 25, 15, 15, 28, 0, time.UTC)
+	cases := []struct {
+		name      string
+		cookieStr string
+		expect    http.Cookie
+	}{
+		{
+			name:      "google.cn NID",
+			cookieStr: "NID=204=Au7rQwn2eharnT1rtKsoQl32M2ASoamoFj5Rk8LKHZgg7YZfo54k88aqBVcUEYxcLKjpSU5dNgGTrRAu4Uiv7G3fIAeT3L87gsJCdqg_dCJ9tMHTufW8pHIUD1KgCDwUSIH60d4cWVsukZpai43pm9vHr3SLHCQk9ueEpYJ5Cx8; expires=Thu, 25-Feb-2021 15:15:28 GMT; path=/; domain=.google.cn; HttpOnly",
+			expect:    http.Cookie{Name: "NID", Value: "204=Au7rQwn2eharnT1rtKsoQl32M2ASoamoFj5Rk8LKHZgg7YZfo54k88aqBVcUEYxcLKjpSU5dNgGTrRAu4Uiv7G3fIAeT3L87gsJCdqg_dCJ9tMHTufW8pHIUD1KgCDwUSIH60d4cWVsukZpai43pm9vHr3SLHCQk9ueEpYJ5Cx8", Expires: expires, Path: "/", Domain: "google.cn", HttpOnly: true},
+		},
+		{
+			name:      "google.com NID with SameSite and Secure",
+			cookieStr: "NID=511=xZfGk; expires=Thu, 25-Feb-2021 15:15:28 GMT; path=/; domain=.google.com; Secure; HttpOnly; SameSite=none",
+			expect:    http.Cookie{Name: "NID", Value: "511=xZfGk", Expires: expires, Path: "/", Domain: "google.com", Secure: true, HttpOnly: true, SameSite: http.SameSiteNoneMode},
+		},
+		{
+			name:      "consent cookie with Max-Age and Priority",
+			cookieStr: "CONSENT=PENDING+987; Max-Age=3600; Path=/; Domain=.google.com; Priority=HIGH",
+			expect:    http.Cookie{Name: "CONSENT", Value: "PENDING+987", MaxAge: 3600, Path: "/", Domain: "google.com", Unparsed: []string{"Priority=HIGH"}},
+		},
+		{
+			name:      "RFC 1123 date",
+			cookieStr: "a=b; Expires=Thu, 25 Feb 2021 15:15:28 GMT",
+			expect:    http.Cookie{Name: "a", Value: "b", Expires: expires},
+		},
+		{
+			name:      "RFC 850 date",
+			cookieStr: "a=b; expires=Thursday, 25-Feb-21 15:15:28 GMT",
+			expect:    http.Cookie{Name: "a", Value: "b", Expires: expires},
+		},
+		{
+			name:      "ANSI C asctime date",
+			cookieStr: "a=b; expires=Thu Feb 25 15:15:28 2021",
+			expect:    http.Cookie{Name: "a", Value: "b", Expires: expires},
+		},
+		{
+			name:      "two digit year before 1970",
+			cookieStr: "a=b; expires=Thu, 25-Feb-69 15:15:28 GMT",
+			expect:    http.Cookie{Name: "a", Value: "b", Expires: time.Date(2069, 2, 25, 15, 15, 28, 0, time.UTC)},
+		},
+		{
+			name:      "invalid date is ignored",
+			cookieStr: "a=b; expires=Thu, 30-Feb-2021 15:15:28 GMT; path=/",
+			expect:    http.Cookie{Name: "a", Value: "b", Path: "/"},
+		},
+		{
+			name:      "Max-Age=0 expires now",
+			cookieStr: "a=b; Max-Age=0",
+			expect:    http.Cookie{Name: "a", Value: "b", MaxAge: -1},
+		},
+		{
+			name:      "invalid Max-Age is ignored",
+			cookieStr: "a=b; Max-Age=+10",
+			expect:    http.Cookie{Name: "a", Value: "b"},
+		},
+		{
+			name:      "quoted value, no spaces and upper case attributes",
+			cookieStr: `a="b c";PATH=/translate_a;DOMAIN=Translate.Google.cn;SECURE`,
+			expect:    http.Cookie{Name: "a", Value: "b c", Path: "/translate_a", Domain: "translate.google.cn", Secure: true},
+		},
+		{
+			name:      "empty value and relative path",
+			cookieStr: "a=; path=translate",
+			expect:    http.Cookie{Name: "a"},
+		},
+	}
+	for _, c := range cases {
+		cookie, err := parseCookieStr(c.cookieStr)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		c.expect.Raw = c.cookieStr
+		c.expect.RawExpires = cookie.RawExpires
+		if !reflect.DeepEqual(cookie, c.expect) {
+			t.Errorf("%s:\nexpect: %+v\ngot:    %+v", c.name, c.expect, cookie)
+		}
+	}
+
+	for _, cookieStr := range []string{"", "HttpOnly", "=b; path=/"} {
+		if _, err := parseCookieStr(cookieStr); err != ErrInvalidCookie {
+			t.Errorf("parseCookieStr(%q): expect ErrInvalidCookie, got: %v", cookieStr, err)
+		}
 	}
-	t.Logf("%+v\n", cookie)
 }
 
 func TestGet(t *testing.T) {
-	cookie, err := Get("https://translate.google.cn")
+	srv := googletranstest.NewServer()
+	defer srv.Close()
+
+	cookies, err := NewCache(WithHostPolicy(AnyHost)).Get(srv.URL)
 	if err != nil {
 		t.Error(err)
 	}
-	t.Logf("%+v\n", cookie)
+	if len(cookies) != 1 || cookies[0].Name != "NID" {
+		t.Errorf("expect the NID cookie, got: %+v", cookies)
+	}
+}
+
+// rewriteTransport sends every request to srv
+type rewriteTransport struct {
+	srv *httptest.Server
+}
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(rt.srv.URL)
+	req = req.Clone(req.Context())
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+	return rt.srv.Client().Transport.RoundTrip(req)
+}
+
+func TestCache(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Add("Set-Cookie", "NID=204=Au7rQwn2; expires=Thu, 25-Feb-2100 15:15:28 GMT; path=/; domain=.google.cn; HttpOnly")
+		w.Header().Add("Set-Cookie", "CONSENT=YES+; expires=Thu, 25-Feb-2100 15:15:28 GMT; path=/; domain=.google.cn")
+	}))
+	defer srv.Close()
+
+	a := NewCache(WithClient(&http.Client{Transport: rewriteTransport{srv}}))
+	b := NewCache(WithClient(&http.Client{Transport: rewriteTransport{srv}}))
+	for i := 0; i < 2; i++ {
+		cookies, err := a.Get("https://translate.google.cn")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, expect := cookieNames(cookies), "CONSENT NID"; got != expect {
+			t.Errorf("expect: %q, got: %q", expect, got)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expect cookies to be fetched once, got: %d", requests)
+	}
+
+	// caches don't share cookies
+	if _, err := b.Get("https://translate.google.cn"); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("expect each cache to fetch its own cookies, got: %d", requests)
+	}
+
+	if _, err := a.Get("https://example.com"); err != ErrInvalidServiceURL {
+		t.Errorf("expect ErrInvalidServiceURL, got: %v", err)
+	}
+}
+
+func TestRequiredCookie(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Add("Set-Cookie", "CONSENT=YES+; Max-Age=3600; path=/")
+		if requests == 1 {
+			// NID expires while CONSENT stays in the jar
+			w.Header().Add("Set-Cookie", "NID=old; Max-Age=0; path=/")
+			return
+		}
+		w.Header().Add("Set-Cookie", "NID=new; Max-Age=3600; path=/")
+	}))
+	defer srv.Close()
+
+	cache := NewCache(WithHostPolicy(AnyHost), WithClient(srv.Client()))
+	for i, expect := range []string{"CONSENT", "CONSENT NID", "CONSENT NID"} {
+		cookies, err := cache.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cookieNames(cookies); got != expect {
+			t.Errorf("get %d: expect: %q, got: %q", i, expect, got)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expect cookies to be refetched once NID expired, got %d requests", requests)
+	}
+	if !cache.Cached(srv.URL) {
+		t.Error("expect the cookies to be cached")
+	}
+
+	// any cookie will do
+	requests = 0
+	cache = NewCache(WithHostPolicy(AnyHost), WithClient(srv.Client()), WithRequiredCookie(""))
+	cache.Get(srv.URL)
+	cache.Get(srv.URL)
+	if requests != 1 {
+		t.Errorf("expect cookies to be fetched once, got %d requests", requests)
+	}
+}
+
+func TestNIDCookie(t *testing.T) {
+	cookies := []*http.Cookie{{Name: "CONSENT", Value: "YES+"}, {Name: "NID", Value: "204"}}
+	if cookie := nidCookie(cookies); cookie.Value != "204" {
+		t.Errorf("expect the NID cookie, got: %+v", cookie)
+	}
+	if cookie := nidCookie(cookies[:1]); cookie.Name != "CONSENT" {
+		t.Errorf("expect the first cookie without NID, got: %+v", cookie)
+	}
+	if cookie := nidCookie(nil); cookie.Name != "" {
+		t.Errorf("expect an empty cookie, got: %+v", cookie)
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	cases := []struct {
+		policy   HostPolicy
+		hostname string
+		expect   bool
+	}{
+		{GoogleHosts, "translate.google.cn", true},
+		{GoogleHosts, "translate.google", false},
+		{GoogleHosts, "127.0.0.1", false},
+		{AnyHost, "127.0.0.1", true},
+		{AnyHost, "", false},
+		{AllowHosts("translate.example.com"), "translate.example.com", true},
+		{AllowHosts("translate.example.com"), "translate.google.com", true},
+		{AllowHosts("translate.example.com"), "example.com", false},
+	}
+	for _, c := range cases {
+		if got := c.policy(c.hostname); got != c.expect {
+			t.Errorf("policy(%q): expect: %v, got: %v", c.hostname, c.expect, got)
+		}
+	}
+}
+
+func TestUpdatePerHost(t *testing.T) {
+	var (
+		m           sync.Mutex
+		slowFetches int
+		release     = make(chan struct{})
+	)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		slowFetches++
+		m.Unlock()
+		<-release
+		w.Header().Add("Set-Cookie", "NID=slow; path=/")
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "NID=fast; path=/")
+	}))
+	defer fast.Close()
+
+	cache := NewCache(WithHostPolicy(AnyHost))
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Update(slow.URL, 10*time.Millisecond); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// the slow host doesn't block the fast one
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan error)
+	go func() {
+		_, err := cache.Update(fast.URL, 0)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("updating the fast host is blocked by the slow one")
+	}
+
+	close(release)
+	wg.Wait()
+	if slowFetches != 1 {
+		t.Errorf("expect concurrent updates of a host to share one fetch, got: %d", slowFetches)
+	}
+}
+
+func TestUpdateContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	cache := NewCache(WithHostPolicy(AnyHost))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := cache.UpdateContext(ctx, srv.URL, time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("expect context.DeadlineExceeded, got: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("the backoff isn't cancelled with ctx")
+	}
+}
+
+func TestUpdateLeaderCancelled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Add("Set-Cookie", "NID=204; path=/")
+	}))
+	defer srv.Close()
+
+	cache := NewCache(WithHostPolicy(AnyHost))
+	leader, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, err := cache.UpdateContext(leader, srv.URL, 0)
+		leaderDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	followerDone := make(chan error)
+	go func() {
+		cookies, err := cache.UpdateContext(context.Background(), srv.URL, 0)
+		if err == nil && cookieNames(cookies) != "NID" {
+			err = errors.New("no NID cookie")
+		}
+		followerDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// the leader gives up, the follower keeps waiting for the shared fetch
+	cancel()
+	if err := <-leaderDone; err != context.Canceled {
+		t.Errorf("expect the leader to get context.Canceled, got: %v", err)
+	}
+	close(release)
+	if err := <-followerDone; err != nil {
+		t.Errorf("expect the follower to get the cookies, got: %v", err)
+	}
 }